@@ -0,0 +1,79 @@
+// Command shprepair repairs shapefiles: it rebuilds the .shx index,
+// rewrites the .shp header with the right length and extents, replaces
+// broken records with null shapes, truncates trailing garbage, and
+// corrects the record count of the .dbf file.
+//
+// Usage:
+//
+//	shprepair [-n] file.shp ...
+//
+// With -n, the files are only validated and their problems listed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ctessum/shapefile"
+)
+
+func main() {
+	dryRun := flag.Bool("n", false, "only list problems, do not repair")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: shprepair [-n] file.shp ...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	status := 0
+	for _, name := range flag.Args() {
+		basename := strings.TrimSuffix(name, ".shp")
+		if *dryRun {
+			problems, err := shapefile.ValidateFiles(basename)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				status = 1
+				continue
+			}
+			for _, p := range problems {
+				fmt.Printf("%s: %v\n", name, p)
+			}
+			if len(problems) > 0 {
+				status = 1
+			}
+			continue
+		}
+		r, err := shapefile.RepairFiles(basename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = 1
+			continue
+		}
+		fmt.Printf("%s: %d records", name, r.Records)
+		if r.Skipped > 0 {
+			fmt.Printf(", %d bytes of broken records removed", r.Skipped)
+		}
+		if len(r.Dropped) > 0 {
+			fmt.Printf(", records %v replaced with null shapes", r.Dropped)
+		}
+		if r.Truncated > 0 {
+			fmt.Printf(", %d trailing bytes removed", r.Truncated)
+		}
+		if r.HeaderChanged {
+			fmt.Print(", header rewritten")
+		}
+		if r.DBFChanged {
+			fmt.Printf(", dbf record count set to %d", r.DBFRows)
+		}
+		if r.DBFRows >= 0 && r.DBFRows != r.Records {
+			fmt.Printf(" (warning: dbf has %d rows)", r.DBFRows)
+		}
+		fmt.Println()
+	}
+	os.Exit(status)
+}
@@ -7,6 +7,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // DBF is documented here: http://www.clicketyclick.dk/databases/xbase/format/dbf.html
@@ -15,14 +16,31 @@ type DBFFile struct {
 	DBFFileHeader    *DBFFileHeader
 	FieldDescriptors []FieldDescriptor
 	FieldIndicies    map[string]int // indicies of each field by name
+	Schema           Schema         // columns of all fields
 	countRead        uint32
 	r                io.Reader
+	ra               io.ReaderAt // nil unless r is an io.ReaderAt
+	offsets          []int       // offset of each field in a row
+	widths           []int       // width of each field in a row
+	projection       []int       // fields returned in rows, nil for all
 }
 
+// OpenDBFFile reads the header of a .dbf file. If r is also an
+// io.ReaderAt, such as an *os.File, rows can be read in any order with
+// ReadRow and whole columns with the column readers.
 func OpenDBFFile(r io.Reader) (dbf *DBFFile, err error) {
 	dbf = &DBFFile{}
 	dbf.r = r
+	dbf.ra, _ = r.(io.ReaderAt)
 	if dbf.DBFFileHeader, err = newDBFFileHeader(r); err != nil {
+		err = &HeaderError{Kind: KindDbf, Err: err}
+		return
+	}
+	if dbf.DBFFileHeader.LenHeader < 33 {
+		// fixed header and terminator at the least
+		err = &HeaderError{Kind: KindDbf, Field: "LenHeader", Offset: 8,
+			Err: &LengthError{Field: "LenHeader", Value: int64(dbf.DBFFileHeader.LenHeader),
+				Min: 33, Max: math.MaxUint16}}
 		return
 	}
 	len_fd := dbf.DBFFileHeader.LenHeader - 32 // the fixed portion of the header is 32 bytes
@@ -31,17 +49,34 @@ func OpenDBFFile(r io.Reader) (dbf *DBFFile, err error) {
 	var fd FieldDescriptor
 	for i := 0; i != num_fd; i++ {
 		if err = binary.Read(dbf.r, l, &fd); err != nil {
+			err = &HeaderError{Kind: KindDbf, Field: "FieldDescriptor",
+				Offset: 32 + 32*int64(i), Err: err}
 			return
 		}
 		dbf.FieldDescriptors = append(dbf.FieldDescriptors, fd)
 		dbf.FieldIndicies[fd.fieldName()] = i
 	}
+	// Some producers store character fields longer than 255 bytes with
+	// the decimal count as the high byte of the length. Use that reading
+	// only if it is what makes the fields fill the record.
+	want := int(dbf.DBFFileHeader.LenRecord)
+	long := dbf.layout(false) != want && dbf.layout(true) == want
+	lenRecord := dbf.layout(long)
+	if lenRecord > int(dbf.DBFFileHeader.LenRecord) {
+		err = &HeaderError{Kind: KindDbf, Field: "LenRecord", Offset: 10,
+			Err: &LengthError{Field: "LenRecord", Value: int64(dbf.DBFFileHeader.LenRecord),
+				Min: int64(lenRecord), Max: math.MaxUint16}}
+		return
+	}
+	dbf.Schema = NewSchema(dbf.Fields())
 	bullshitByte := make([]byte, 1)
 	var n int
 	if n, err = r.Read(bullshitByte); err != nil || n != 1 {
 		if err == nil {
 			err = fmt.Errorf("couldn't read bullshit byte!")
 		}
+		err = &HeaderError{Kind: KindDbf, Field: "Terminator",
+			Offset: 32 + 32*int64(num_fd), Err: err}
 		return
 	}
 	dbf.countRead = (uint32)(0)
@@ -61,74 +96,122 @@ func (dbf *DBFFile) NextRecord() (entry []interface{}, err error) {
 		if err == nil {
 			err = fmt.Errorf("expected %d bytes, read: %d", dbf.DBFFileHeader.LenRecord, n)
 		}
+		err = &RecordError{Kind: KindDbf, Record: int(dbf.countRead) + 1,
+			Offset: dbf.rowOffset(int(dbf.countRead)), Err: err}
 		return
 	}
+	dbf.countRead++
+	return dbf.parseRecord(int(dbf.countRead)-1, rawEntry), nil
+}
+
+// rowOffset returns the byte offset of row i, counting from zero.
+func (dbf *DBFFile) rowOffset(i int) int64 {
+	return int64(dbf.DBFFileHeader.LenHeader) + int64(i)*int64(dbf.DBFFileHeader.LenRecord)
+}
+
+// parseRecord decodes the fields of raw row i, counting from zero, or
+// only those set by SetFields. The entry of a deleted record is nil.
+// Values that cannot be parsed are returned in the entry as *FieldError.
+func (dbf *DBFFile) parseRecord(row int, rawEntry []byte) (entry []interface{}) {
 	if 0x2a == rawEntry[0] { // record deleted
 		return
 	}
+	if dbf.projection == nil {
+		entry = make([]interface{}, len(dbf.FieldDescriptors))
+		for i := range dbf.FieldDescriptors {
+			entry[i] = dbf.parseField(row, i, rawEntry)
+		}
+		return
+	}
+	entry = make([]interface{}, len(dbf.projection))
+	for k, i := range dbf.projection {
+		entry[k] = dbf.parseField(row, i, rawEntry)
+	}
+	return
+}
 
-	entry = make([]interface{}, len(dbf.FieldDescriptors))
-	var offset = 1
+// layout sets the offset and width of each field in a row, with or
+// without long character fields, and returns the length of a row.
+func (dbf *DBFFile) layout(long bool) int {
+	dbf.offsets, dbf.widths = dbf.offsets[:0], dbf.widths[:0]
+	lenRecord := 1 // deletion flag
+	for i := range dbf.FieldDescriptors {
+		width := dbf.FieldDescriptors[i].width(long)
+		dbf.offsets = append(dbf.offsets, lenRecord)
+		dbf.widths = append(dbf.widths, width)
+		lenRecord += width
+	}
+	return lenRecord
+}
 
-	for i, desc := range dbf.FieldDescriptors {
-		rawField := rawEntry[offset : offset+(int)(desc.FieldLength)]
-		offset += (int)(desc.FieldLength)
+// parseField decodes field i of raw row, counting from zero. A value
+// that cannot be decoded is returned as a *FieldError.
+func (dbf *DBFFile) parseField(row, i int, rawEntry []byte) interface{} {
+	desc := dbf.FieldDescriptors[i]
+	offset := dbf.offsets[i]
+	rawField := rawEntry[offset : offset+dbf.widths[i]]
+	fieldError := func(err error) error {
+		return &FieldError{Record: row + 1, Field: desc.fieldName(),
+			Offset: dbf.rowOffset(row) + int64(offset), Err: err}
+	}
 
-		stringField := (string)(rawField)
-		stringField = strings.TrimSpace(stringField)
-		// Remove any '\x00' null characters
-		if i := strings.IndexRune(stringField, '\x00'); i > -1 {
-			stringField = stringField[0:i]
-		}
+	stringField := (string)(rawField)
+	stringField = strings.TrimSpace(stringField)
+	// Remove any '\x00' null characters
+	if i := strings.IndexRune(stringField, '\x00'); i > -1 {
+		stringField = stringField[0:i]
+	}
 
-		switch desc.FieldType {
-		case Character, VarCharVar:
-			entry[i] = stringField
-		case Number, Integer:
-			if desc.DecimalCount == 0 {
-				var val int64
-				if val, err = strconv.ParseInt(stringField, 10, 64); err != nil {
-					// If the float isn't valid, return a the error message
-					// in the data field and let the calling program handle
-					// it.
-					entry[i] = fmt.Errorf(err.Error())
-					err = nil
-				} else {
-					entry[i] = int(val)
-				}
-				break
-			}
-			// handle it like a float ...
-			fallthrough
-		case Float, Double:
-			if entry[i], err = strconv.ParseFloat(stringField, 64); err != nil {
+	switch desc.FieldType {
+	case Character, VarCharVar:
+		return stringField
+	case Number, Integer:
+		if desc.DecimalCount == 0 {
+			val, err := strconv.ParseInt(stringField, 10, 64)
+			if err != nil {
 				// If the float isn't valid, return a the error message
 				// in the data field and let the calling program handle
 				// it.
-				if stringField == "" {
-					entry[i] = math.NaN()
-				} else {
-					entry[i] = fmt.Errorf(err.Error())
-				}
-				err = nil
+				return fieldError(err)
 			}
-		case Logical:
-			switch stringField {
-			case "1", "T", "t", "Y", "y":
-				entry[i] = true
-			case "0", "F", "f", "N", "n":
-				entry[i] = false
-			default:
-				err = fmt.Errorf("Unsupported logical value `%v`",
-					stringField)
-				return
+			return int(val)
+		}
+		// handle it like a float ...
+		fallthrough
+	case Float, Double:
+		val, err := strconv.ParseFloat(stringField, 64)
+		if err != nil {
+			// If the float isn't valid, return a the error message
+			// in the data field and let the calling program handle
+			// it.
+			if stringField == "" {
+				return math.NaN()
 			}
-		default:
-			err = fmt.Errorf("unsupported type: %c", desc.FieldType)
+			return fieldError(err)
+		}
+		return val
+	case Logical:
+		switch stringField {
+		case "1", "T", "t", "Y", "y":
+			return true
+		case "0", "F", "f", "N", "n":
+			return false
+		case "", "?": // not initialized
+			return nil
+		}
+		return fieldError(fmt.Errorf("Unsupported logical value `%v`",
+			stringField))
+	case Date:
+		if stringField == "" {
+			return nil
 		}
+		val, err := time.Parse("20060102", stringField)
+		if err != nil {
+			return fieldError(err)
+		}
+		return val
 	}
-	dbf.countRead++
-	return
+	return fieldError(fmt.Errorf("unsupported type: %c", desc.FieldType))
 }
 
 // http://www.clicketyclick.dk/databases/xbase/format/dbf.html#DBF_STRUCT
@@ -204,10 +287,42 @@ type FieldDescriptor struct {
 func (f *FieldDescriptor) String() string {
 	str := fmt.Sprintf("Name : %s\n", f.fieldName())
 	str += fmt.Sprintf("Type : %c\n", f.FieldType)
-	str += fmt.Sprintf("Len  : %d\n", f.FieldLength)
+	str += fmt.Sprintf("Len  : %d\n", f.Width())
 	str += fmt.Sprintf("Count: %d\n", f.DecimalCount)
 	return str
 }
+
+// Width returns the number of bytes of the field in a row. Character
+// fields longer than 255 bytes keep the high byte of their width in
+// DecimalCount. Files that store something else there are read with
+// the width in FieldLength alone; DBFFile.Fields returns descriptors
+// whose Width is that of the file.
+func (f *FieldDescriptor) Width() int {
+	return f.width(true)
+}
+
+// setWidth sets the width of the field, in the encoding of Width. Widths
+// are clamped to what the encoding can hold: 65535 bytes for character
+// fields and 255 for the others.
+func (f *FieldDescriptor) setWidth(width int) {
+	limit := math.MaxUint8
+	if f.FieldType == Character {
+		limit = math.MaxUint16
+	}
+	width = max(0, min(width, limit))
+	f.FieldLength = uint8(width)
+	if f.FieldType == Character {
+		f.DecimalCount = uint8(width >> 8)
+	}
+}
+
+func (f *FieldDescriptor) width(long bool) int {
+	if long && f.FieldType == Character {
+		return int(f.FieldLength) | int(f.DecimalCount)<<8
+	}
+	return int(f.FieldLength)
+}
+
 func (f *FieldDescriptor) fieldName() string {
 	for i, b := range f.FieldName_ {
 		if b == '\000' {
@@ -0,0 +1,191 @@
+package shapefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// errNoReaderAt is returned for random access to a .dbf file opened
+// from a plain io.Reader.
+var errNoReaderAt = errors.New("dbf file not opened from an io.ReaderAt")
+
+// SetFields restricts the rows returned by NextRecord, ReadRow and Rows
+// to the named fields, in that order, so that the other fields are not
+// parsed. With no names, rows hold all fields again.
+func (dbf *DBFFile) SetFields(names ...string) error {
+	if len(names) == 0 {
+		dbf.projection = nil
+		return nil
+	}
+	projection := make([]int, len(names))
+	for k, name := range names {
+		i, ok := dbf.FieldIndicies[name]
+		if !ok {
+			return fmt.Errorf("no field %q", name)
+		}
+		projection[k] = i
+	}
+	dbf.projection = projection
+	return nil
+}
+
+// Fields returns copies of the descriptors of the fields of the rows,
+// following SetFields. Their Width is the width of the field in the
+// file, so they can be written as they are.
+func (dbf *DBFFile) Fields() []FieldDescriptor {
+	projection := dbf.projection
+	if projection == nil {
+		projection = make([]int, len(dbf.FieldDescriptors))
+		for i := range projection {
+			projection[i] = i
+		}
+	}
+	fields := make([]FieldDescriptor, len(projection))
+	for k, i := range projection {
+		fields[k] = dbf.FieldDescriptors[i]
+		fields[k].setWidth(dbf.widths[i])
+	}
+	return fields
+}
+
+// ReadRow returns row i, counting from zero, as NextRecord would. It
+// needs the file to have been opened from an io.ReaderAt, and does not
+// move the position of NextRecord.
+func (dbf *DBFFile) ReadRow(i int) ([]interface{}, error) {
+	if dbf.ra == nil {
+		return nil, errNoReaderAt
+	}
+	if i < 0 || i >= int(dbf.DBFFileHeader.NumRecords) {
+		return nil, fmt.Errorf("row %d out of range", i)
+	}
+	raw := make([]byte, dbf.DBFFileHeader.LenRecord)
+	// a ReaderAt may return io.EOF with a complete row at the end
+	if n, err := dbf.ra.ReadAt(raw, dbf.rowOffset(i)); n < len(raw) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, &RecordError{Kind: KindDbf, Record: i + 1, Offset: dbf.rowOffset(i), Err: err}
+	}
+	return dbf.parseRecord(i, raw), nil
+}
+
+// skipTo moves the position of NextRecord forward to row i, counting
+// from zero, without decoding the rows in between.
+func (dbf *DBFFile) skipTo(i int) error {
+	if i < int(dbf.countRead) {
+		return fmt.Errorf("row %d has been read past", i)
+	}
+	n := min(i, int(dbf.DBFFileHeader.NumRecords)) - int(dbf.countRead)
+	size := int64(dbf.DBFFileHeader.LenRecord)
+	if _, err := io.CopyN(io.Discard, dbf.r, int64(n)*size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &RecordError{Kind: KindDbf, Record: int(dbf.countRead) + 1,
+			Offset: dbf.rowOffset(int(dbf.countRead)), Err: err}
+	}
+	dbf.countRead += uint32(n)
+	return nil
+}
+
+// eachRow calls fn with every raw row of the file, reading many rows at
+// a time.
+func (dbf *DBFFile) eachRow(fn func(row int, raw []byte) error) error {
+	if dbf.ra == nil {
+		return errNoReaderAt
+	}
+	n, size := int(dbf.DBFFileHeader.NumRecords), int(dbf.DBFFileHeader.LenRecord)
+	batch := max(1, 64*1024/size)
+	buf := make([]byte, batch*size)
+	for start := 0; start < n; start += batch {
+		rows := min(batch, n-start)
+		nr, err := dbf.ra.ReadAt(buf[:rows*size], dbf.rowOffset(start))
+		if nr < rows*size {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			bad := start + nr/size
+			return &RecordError{Kind: KindDbf, Record: bad + 1, Offset: dbf.rowOffset(bad), Err: err}
+		}
+		for k := 0; k < rows; k++ {
+			if err = fn(start+k, buf[k*size:(k+1)*size]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// column decodes field name of every row with conv, which reports
+// whether it accepts the value. Deleted rows give deleted.
+func column[T any](dbf *DBFFile, name string, deleted T, conv func(v interface{}) (T, bool)) ([]T, error) {
+	i, ok := dbf.FieldIndicies[name]
+	if !ok {
+		return nil, fmt.Errorf("no field %q", name)
+	}
+	values := make([]T, dbf.DBFFileHeader.NumRecords)
+	err := dbf.eachRow(func(row int, raw []byte) error {
+		if raw[0] == 0x2a { // record deleted
+			values[row] = deleted
+			return nil
+		}
+		v := dbf.parseField(row, i, raw)
+		if err, isErr := v.(error); isErr {
+			return err
+		}
+		var ok bool
+		if values[row], ok = conv(v); !ok {
+			return &FieldError{Record: row + 1, Field: name,
+				Offset: dbf.rowOffset(row) + int64(dbf.offsets[i]),
+				Err:    fmt.Errorf("cannot read %c field as %T", dbf.FieldDescriptors[i].FieldType, values[row])}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// StringColumn returns the values of a character field for all rows.
+// Only that field is parsed. Deleted rows give empty strings.
+func (dbf *DBFFile) StringColumn(name string) ([]string, error) {
+	return column(dbf, name, "", func(v interface{}) (string, bool) {
+		s, ok := v.(string)
+		return s, ok
+	})
+}
+
+// IntColumn returns the values of a numeric field without decimals for
+// all rows. Only that field is parsed. Deleted rows give zero.
+func (dbf *DBFFile) IntColumn(name string) ([]int, error) {
+	return column(dbf, name, 0, func(v interface{}) (int, bool) {
+		i, ok := v.(int)
+		return i, ok
+	})
+}
+
+// FloatColumn returns the values of a numeric field for all rows. Only
+// that field is parsed. Empty values and deleted rows give NaN.
+func (dbf *DBFFile) FloatColumn(name string) ([]float64, error) {
+	return column(dbf, name, math.NaN(), func(v interface{}) (float64, bool) {
+		switch v := v.(type) {
+		case float64:
+			return v, true
+		case int:
+			return float64(v), true
+		}
+		return 0, false
+	})
+}
+
+// BoolColumn returns the values of a logical field for all rows. Only
+// that field is parsed. Deleted rows give false.
+func (dbf *DBFFile) BoolColumn(name string) ([]bool, error) {
+	return column(dbf, name, false, func(v interface{}) (bool, bool) {
+		b, ok := v.(bool)
+		return b, ok
+	})
+}
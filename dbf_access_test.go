@@ -0,0 +1,201 @@
+package shapefile
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDBFRandomAccess(t *testing.T) {
+	f, err := os.Open(dbf_test_fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dbf, err := OpenDBFFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]interface{}
+	for {
+		row, err := dbf.NextRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	for _, i := range []int{298, 0, 150} {
+		row, err := dbf.ReadRow(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(row, rows[i]) {
+			t.Errorf("row %d: got %v, want %v", i, row, rows[i])
+		}
+	}
+	if _, err = dbf.ReadRow(299); err == nil {
+		t.Errorf("no error for row out of range")
+	}
+
+	if err = dbf.SetFields("LAND_NAME", "WKR_NR"); err != nil {
+		t.Fatal(err)
+	}
+	row, err := dbf.ReadRow(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{rows[7][3], rows[7][0]}; !reflect.DeepEqual(row, want) {
+		t.Errorf("projected row: got %v, want %v", row, want)
+	}
+	if fields := dbf.Fields(); len(fields) != 2 || fields[0].fieldName() != "LAND_NAME" {
+		t.Errorf("projected fields %v", fields)
+	}
+	if err = dbf.SetFields("NO_SUCH_FIELD"); err == nil {
+		t.Errorf("no error for unknown field")
+	}
+
+	numbers, err := dbf.IntColumn("WKR_NR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	floats, err := dbf.FloatColumn("WKR_NR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := dbf.StringColumn("LAND_NAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		if numbers[i] != row[0] || floats[i] != float64(numbers[i]) || names[i] != row[3] {
+			t.Fatalf("row %d: columns %v %v %q, row %v", i, numbers[i], floats[i], names[i], row)
+		}
+	}
+	if _, err = dbf.StringColumn("WKR_NR"); err == nil {
+		t.Errorf("read a numeric field as strings")
+	}
+
+	f.Seek(0, io.SeekStart)
+	if dbf, err = OpenDBFFile(bufio.NewReader(f)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dbf.ReadRow(0); err != errNoReaderAt {
+		t.Errorf("got %v, want %v", err, errNoReaderAt)
+	}
+}
+
+func TestDBFLongCharacterField(t *testing.T) {
+	long := strings.Repeat("abcdefghij", 40)
+	f := new(memFile)
+	w, err := NewDBFWriter(f, []FieldDescriptor{
+		NewFieldDescriptor("NOTE", Character, 400, 0),
+		NewFieldDescriptor("N", Number, 4, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write([]interface{}{long, 12}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := w.DBFFileHeader.LenRecord; n != 405 {
+		t.Errorf("record length %d, want 405", n)
+	}
+
+	dbf, err := OpenDBFFile(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width := dbf.FieldDescriptors[0].Width(); width != 400 {
+		t.Errorf("width %d, want 400", width)
+	}
+	row, err := dbf.NextRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{long, 12}; !reflect.DeepEqual(row, want) {
+		t.Errorf("got %v, want %v", row, want)
+	}
+
+	// a short field with something else in its decimal count
+	f = new(memFile)
+	if w, err = NewDBFWriter(f, []FieldDescriptor{NewFieldDescriptor("NAME", Character, 10, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write([]interface{}{"abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.buf[32+17] = 3 // DecimalCount
+	if dbf, err = OpenDBFFile(f.reader()); err != nil {
+		t.Fatal(err)
+	}
+	if fd := dbf.FieldDescriptors[0]; fd.DecimalCount != 3 {
+		t.Errorf("descriptor changed to %+v", fd)
+	}
+	if width := dbf.Fields()[0].Width(); width != 10 || dbf.Schema[0].Width != 10 {
+		t.Errorf("width %d, schema width %d, want 10", width, dbf.Schema[0].Width)
+	}
+	if row, err = dbf.NextRecord(); err != nil {
+		t.Fatal(err)
+	}
+	if row[0] != "abc" {
+		t.Errorf("got %v", row)
+	}
+}
+
+// eofReaderAt returns io.EOF with reads that end at the end of the data,
+// as io.ReaderAt allows.
+type eofReaderAt struct{ data []byte }
+
+func (r eofReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if off+int64(n) == int64(len(r.data)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r eofReaderAt) Read(p []byte) (int, error) { return 0, io.EOF }
+
+func TestDBFReadRowAtEnd(t *testing.T) {
+	f := new(memFile)
+	w, err := NewDBFWriter(f, []FieldDescriptor{NewFieldDescriptor("N", Number, 4, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = w.Write([]interface{}{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := OpenDBFFile(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without the end-of-file marker, the last row ends the file
+	dbf.ra = eofReaderAt{f.buf[:len(f.buf)-1]}
+	if row, err := dbf.ReadRow(1); err != nil || !reflect.DeepEqual(row, []interface{}{1}) {
+		t.Errorf("last row: got %v, %v", row, err)
+	}
+	dbf.ra = eofReaderAt{f.buf[:len(f.buf)-3]}
+	if _, err = dbf.ReadRow(1); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated row: got %v", err)
+	}
+}
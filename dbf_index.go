@@ -0,0 +1,535 @@
+package shapefile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Index files are documented here:
+// http://www.clicketyclick.dk/databases/xbase/format/ndx.html
+// http://www.clicketyclick.dk/databases/xbase/format/mdx.html
+// http://www.clicketyclick.dk/databases/xbase/format/cdx.html
+
+// DBFIndex is a B-tree index of a .dbf file, read from a dBASE III .ndx
+// file or from a tag of a dBASE IV .mdx or FoxPro .cdx file. Nodes are
+// read from the file as lookups need them.
+//
+// Keys are given as strings for character indexes, numbers for numeric
+// ones and time.Time values or Julian day numbers for dates. A .cdx file
+// does not record the type of its keys, so KeyType is zero for its tags
+// and the type of the key given to a lookup is used.
+type DBFIndex struct {
+	Name       string    // tag name, empty for .ndx files
+	Expression string    // key expression, in the language of the producer
+	KeyType    FieldType // Character, Number or Date
+	Unique     bool
+	Descending bool
+
+	r      io.ReaderAt
+	kind   FileKind
+	root   int64 // byte offset of the root node
+	keyLen int
+	// sizes of the entries and nodes of .ndx and .mdx files
+	entryLen, nodeLen int
+}
+
+// indexNode is a node of an index. Leaves point to record numbers and
+// other nodes to the byte offsets of their children. Other nodes may
+// have one more pointer than keys, to the child after the last key.
+type indexNode struct {
+	leaf bool
+	keys []string
+	ptrs []int64
+}
+
+// indexKey is a key decoded for comparison: text, or a number for the
+// numeric and date keys of .ndx and .mdx files.
+type indexKey struct {
+	s string
+	f float64
+}
+
+// maxIndexDepth bounds the depth of the B-trees, so that corrupt files
+// with cycles between nodes fail rather than recurse forever.
+const maxIndexDepth = 32
+
+// OpenNDX reads the header of a dBASE III .ndx file.
+func OpenNDX(r io.ReaderAt) (*DBFIndex, error) {
+	h, err := readIndex(r, 0, 512)
+	if err != nil {
+		return nil, &HeaderError{Kind: KindNdx, Err: err}
+	}
+	x := &DBFIndex{r: r, kind: KindNdx, root: int64(l.Uint32(h)) * 512,
+		keyLen: int(l.Uint16(h[12:])), entryLen: int(l.Uint16(h[18:])), nodeLen: 512,
+		KeyType: Character, Unique: h[22] != 0, Expression: cString(h[24:])}
+	if l.Uint16(h[16:]) != 0 {
+		x.KeyType = Number
+	}
+	if x.keyLen < 1 || x.keyLen > 100 {
+		return nil, &HeaderError{Kind: KindNdx, Field: "KeyLength", Offset: 12,
+			Err: &LengthError{Field: "KeyLength", Value: int64(x.keyLen), Min: 1, Max: 100}}
+	}
+	if x.entryLen < x.keyLen+8 || x.entryLen > 512-4 {
+		return nil, &HeaderError{Kind: KindNdx, Field: "KeyEntryLength", Offset: 18,
+			Err: &LengthError{Field: "KeyEntryLength", Value: int64(x.entryLen),
+				Min: int64(x.keyLen + 8), Max: 512 - 4}}
+	}
+	if x.KeyType == Number && x.keyLen != 8 {
+		return nil, &HeaderError{Kind: KindNdx, Field: "KeyLength", Offset: 12,
+			Err: fmt.Errorf("numeric keys of %d bytes", x.keyLen)}
+	}
+	return x, nil
+}
+
+// OpenMDX reads the headers of the tags of a dBASE IV .mdx file.
+func OpenMDX(r io.ReaderAt) ([]*DBFIndex, error) {
+	h, err := readIndex(r, 0, 544)
+	if err != nil {
+		return nil, &HeaderError{Kind: KindMdx, Err: err}
+	}
+	nodeLen := int(l.Uint16(h[22:]))
+	if nodeLen == 0 {
+		nodeLen = 512 * int(l.Uint16(h[20:]))
+	}
+	if nodeLen < 512 || nodeLen%512 != 0 {
+		return nil, &HeaderError{Kind: KindMdx, Field: "BlockSize", Offset: 22,
+			Err: fmt.Errorf("block size %d is not a multiple of 512", nodeLen)}
+	}
+	tagLen, numTags := int(h[26]), int(l.Uint16(h[28:]))
+	if tagLen < 21 {
+		return nil, &HeaderError{Kind: KindMdx, Field: "TagLength", Offset: 26,
+			Err: &LengthError{Field: "TagLength", Value: int64(tagLen), Min: 21, Max: 255}}
+	}
+	tags, err := readIndex(r, 544, numTags*tagLen)
+	if err != nil {
+		return nil, &HeaderError{Kind: KindMdx, Field: "TagTable", Offset: 544, Err: err}
+	}
+
+	var idx []*DBFIndex
+	for i := 0; i < numTags; i++ {
+		tag := tags[i*tagLen:]
+		offset := int64(l.Uint32(tag)) * 512
+		th, err := readIndex(r, offset, 512)
+		if err != nil {
+			return nil, &HeaderError{Kind: KindMdx, Field: "TagHeader", Offset: offset, Err: err}
+		}
+		x := &DBFIndex{r: r, kind: KindMdx, root: int64(l.Uint32(th)) * 512,
+			keyLen: int(l.Uint16(th[12:])), entryLen: int(l.Uint16(th[18:])), nodeLen: nodeLen,
+			Name: cString(tag[4:15]), KeyType: FieldType(tag[20]), Expression: cString(th[24:]),
+			Unique: th[8]&0x40 != 0 || th[23] != 0, Descending: th[8]&0x08 != 0}
+		switch {
+		case x.keyLen < 1 || x.entryLen < x.keyLen+4 || x.entryLen > nodeLen-8:
+			err = &LengthError{Field: "KeyItemLength", Value: int64(x.entryLen),
+				Min: int64(x.keyLen + 4), Max: int64(nodeLen - 8)}
+		case x.KeyType == Character:
+		case x.KeyType == Number && (x.keyLen == 8 || x.keyLen == 12),
+			x.KeyType == Date && x.keyLen == 8:
+		default:
+			err = fmt.Errorf("tag %s: %c keys of %d bytes", x.Name, x.KeyType, x.keyLen)
+		}
+		if err != nil {
+			return nil, &HeaderError{Kind: KindMdx, Field: "TagHeader", Offset: offset, Err: err}
+		}
+		idx = append(idx, x)
+	}
+	return idx, nil
+}
+
+// OpenCDX reads the headers of the tags of a FoxPro .cdx file. The tags
+// are listed in a B-tree of their names, so they come sorted by name.
+func OpenCDX(r io.ReaderAt) ([]*DBFIndex, error) {
+	dir, err := openCDXTag(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	var idx []*DBFIndex
+	_, err = dir.walk(dir.root, nil, nil, ' ', 0, func(k indexKey, offset int64) error {
+		x, err := openCDXTag(r, offset)
+		if err != nil {
+			return err
+		}
+		x.Name = strings.TrimRight(k.s, " \x00")
+		idx = append(idx, x)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// openCDXTag reads the header of a .cdx tag, or of the directory of tags
+// at the start of the file.
+func openCDXTag(r io.ReaderAt, offset int64) (*DBFIndex, error) {
+	h, err := readIndex(r, offset, 1024)
+	if err != nil {
+		return nil, &HeaderError{Kind: KindCdx, Offset: offset, Err: err}
+	}
+	x := &DBFIndex{r: r, kind: KindCdx, root: int64(l.Uint32(h)), keyLen: int(l.Uint16(h[12:])),
+		Unique: h[14]&0x01 != 0, Descending: l.Uint16(h[502:]) != 0, Expression: cString(h[512:])}
+	if x.keyLen < 1 || x.keyLen > 240 {
+		return nil, &HeaderError{Kind: KindCdx, Field: "KeyLength", Offset: offset + 12,
+			Err: &LengthError{Field: "KeyLength", Value: int64(x.keyLen), Min: 1, Max: 240}}
+	}
+	return x, nil
+}
+
+// Find returns the numbers of the records whose key is key, counting
+// from one as in the .dbf file, in index order.
+func (x *DBFIndex) Find(key interface{}) ([]int, error) {
+	return x.Range(key, key)
+}
+
+// Range returns the numbers of the records whose keys are from lo to hi,
+// counting from one as in the .dbf file, in index order. A nil bound
+// leaves that end of the range open.
+func (x *DBFIndex) Range(lo, hi interface{}) (records []int, err error) {
+	pad := byte(' ')
+	var bounds [2]*indexKey
+	for i, v := range []interface{}{lo, hi} {
+		if v == nil {
+			continue
+		}
+		k, p, err := x.searchKey(v)
+		if err != nil {
+			return nil, err
+		}
+		if bounds[0] != nil && p != pad {
+			return nil, fmt.Errorf("bounds %v and %v are of different types", lo, hi)
+		}
+		bounds[i], pad = &k, p
+	}
+	if x.Descending && x.kind == KindMdx {
+		// dBASE IV stores the keys of descending tags in that order
+		bounds[0], bounds[1] = bounds[1], bounds[0]
+	}
+	_, err = x.walk(x.root, bounds[0], bounds[1], pad, 0, func(_ indexKey, rec int64) error {
+		records = append(records, int(rec))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// walk calls fn with the keys of the subtree at offset that are from lo
+// to hi, and the records they point to, in index order. It reports
+// whether a key past hi was found, which ends the walk. pad is the byte
+// that fills the trailing part of .cdx keys.
+func (x *DBFIndex) walk(offset int64, lo, hi *indexKey, pad byte, depth int,
+	fn func(k indexKey, rec int64) error) (done bool, err error) {
+	if depth > maxIndexDepth {
+		return false, fmt.Errorf("%s node at byte %d: more than %d levels", x.kind, offset, maxIndexDepth)
+	}
+	node, err := x.readNode(offset, pad)
+	if err != nil {
+		return false, err
+	}
+	for i, ptr := range node.ptrs {
+		var k indexKey
+		if i < len(node.keys) {
+			k = x.key(node.keys[i])
+			if lo != nil && x.compare(k, *lo) < 0 {
+				// the key of a child is the last one below it
+				continue
+			}
+		}
+		if node.leaf {
+			if hi != nil && x.compare(k, *hi) > 0 {
+				return true, nil
+			}
+			if err = fn(k, ptr); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if done, err = x.walk(ptr, lo, hi, pad, depth+1, fn); done || err != nil {
+			return done, err
+		}
+	}
+	return false, nil
+}
+
+// compare orders keys in the order of the index, which is reversed for
+// descending .mdx tags.
+func (x *DBFIndex) compare(a, b indexKey) int {
+	c := 0
+	switch {
+	case x.kind == KindCdx || x.KeyType == Character:
+		c = strings.Compare(a.s, b.s)
+	case a.f < b.f:
+		c = -1
+	case a.f > b.f:
+		c = 1
+	}
+	if x.Descending && x.kind == KindMdx {
+		c = -c
+	}
+	return c
+}
+
+// key decodes a key as stored in a node.
+func (x *DBFIndex) key(raw string) indexKey {
+	switch {
+	case x.kind == KindCdx || x.KeyType == Character:
+		return indexKey{s: raw}
+	case x.kind == KindMdx && x.KeyType == Number && len(raw) == 12:
+		return indexKey{f: mdxNumber([]byte(raw))}
+	}
+	return indexKey{f: math.Float64frombits(l.Uint64([]byte(raw)))}
+}
+
+// searchKey encodes v as a key of the index, and returns the byte that
+// fills .cdx keys of its type.
+func (x *DBFIndex) searchKey(v interface{}) (k indexKey, pad byte, err error) {
+	var f float64
+	switch v := v.(type) {
+	case string:
+		if x.kind != KindCdx && x.KeyType != Character {
+			return k, 0, fmt.Errorf("string key %q for %c index", v, x.KeyType)
+		}
+		if len(v) > x.keyLen {
+			v = v[:x.keyLen]
+		}
+		return indexKey{s: v + strings.Repeat(" ", x.keyLen-len(v))}, ' ', nil
+	case int:
+		f = float64(v)
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case float32:
+		f = float64(v)
+	case float64:
+		f = v
+	case time.Time:
+		f = julianDay(v)
+	default:
+		return k, 0, fmt.Errorf("unsupported key type: %T", v)
+	}
+	if x.kind != KindCdx {
+		if x.KeyType == Character {
+			return k, 0, fmt.Errorf("%T key for character index", v)
+		}
+		return indexKey{f: f}, 0, nil
+	}
+	if x.keyLen != 8 {
+		return k, 0, fmt.Errorf("%T key for index of %d byte keys", v, x.keyLen)
+	}
+	// .cdx numbers are stored so that their bytes sort in numeric order
+	u := math.Float64bits(f)
+	if f >= 0 {
+		u |= 1 << 63
+	} else {
+		u = ^u
+	}
+	buf := make([]byte, 8)
+	b.PutUint64(buf, u)
+	return indexKey{s: string(buf)}, 0, nil
+}
+
+// readNode reads the node at offset.
+func (x *DBFIndex) readNode(offset int64, pad byte) (*indexNode, error) {
+	var node *indexNode
+	var err error
+	switch x.kind {
+	case KindCdx:
+		node, err = x.cdxNode(offset, pad)
+	default:
+		node, err = x.node(offset)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s node at byte %d: %v", x.kind, offset, err)
+	}
+	return node, nil
+}
+
+// node reads a node of a .ndx or .mdx file. Entries of .ndx nodes hold
+// the child, zero in leaves, the record number and the key. Entries of
+// .mdx nodes hold the child or record number and the key, after an 8
+// byte header, and leaves have no pointer after their last key.
+func (x *DBFIndex) node(offset int64) (*indexNode, error) {
+	buf, err := readIndex(x.r, offset, x.nodeLen)
+	if err != nil {
+		return nil, err
+	}
+	start, n := 4, int(l.Uint32(buf))
+	if x.kind == KindMdx {
+		start = 8
+	}
+	entry := func(i int) []byte {
+		if e := start + i*x.entryLen; e+x.entryLen <= len(buf) {
+			return buf[e : e+x.entryLen]
+		}
+		return nil
+	}
+	if n > 0 && entry(n-1) == nil {
+		return nil, &LengthError{Field: "NumKeys", Value: int64(n),
+			Min: 0, Max: int64((len(buf) - start) / x.entryLen)}
+	}
+	// next returns the child after the last key, which .mdx leaves have
+	// as zero.
+	next := func() (uint32, error) {
+		if p := start + n*x.entryLen; p+4 <= len(buf) {
+			return l.Uint32(buf[p:]), nil
+		}
+		return 0, &LengthError{Field: "NumKeys", Value: int64(n),
+			Min: 0, Max: int64((len(buf) - start - 4) / x.entryLen)}
+	}
+
+	node := new(indexNode)
+	if x.kind == KindNdx {
+		node.leaf = l.Uint32(buf[start:]) == 0
+	} else {
+		child, err := next()
+		if err != nil {
+			return nil, err
+		}
+		node.leaf = child == 0
+	}
+	for i := 0; i < n; i++ {
+		e := entry(i)
+		switch {
+		case x.kind == KindMdx && node.leaf:
+			node.ptrs = append(node.ptrs, int64(l.Uint32(e)))
+		case x.kind == KindMdx:
+			node.ptrs = append(node.ptrs, int64(l.Uint32(e))*512)
+		case node.leaf:
+			node.ptrs = append(node.ptrs, int64(l.Uint32(e[4:])))
+			e = e[4:]
+		default:
+			node.ptrs = append(node.ptrs, int64(l.Uint32(e))*512)
+			e = e[4:]
+		}
+		node.keys = append(node.keys, string(e[4:4+x.keyLen]))
+	}
+	if !node.leaf {
+		child, err := next()
+		if err != nil {
+			return nil, err
+		}
+		node.ptrs = append(node.ptrs, int64(child)*512)
+	}
+	return node, nil
+}
+
+// cdxNode reads a node of a .cdx file. Other nodes than leaves hold
+// keys followed by big-endian record numbers and children. Leaves are
+// compressed: each key drops the bytes it shares with the key before
+// it, and its trailing blanks, which are spaces for character keys and
+// zero bytes for others.
+func (x *DBFIndex) cdxNode(offset int64, pad byte) (*indexNode, error) {
+	buf, err := readIndex(x.r, offset, 512)
+	if err != nil {
+		return nil, err
+	}
+	attr, n := l.Uint16(buf), int(l.Uint16(buf[2:]))
+	node := &indexNode{leaf: attr&0x02 != 0}
+	if !node.leaf {
+		if 12+n*(x.keyLen+8) > len(buf) {
+			return nil, &LengthError{Field: "NumKeys", Value: int64(n),
+				Min: 0, Max: int64((len(buf) - 12) / (x.keyLen + 8))}
+		}
+		for i := 0; i < n; i++ {
+			e := buf[12+i*(x.keyLen+8):]
+			node.keys = append(node.keys, string(e[:x.keyLen]))
+			node.ptrs = append(node.ptrs, int64(b.Uint32(e[x.keyLen+4:])))
+		}
+		return node, nil
+	}
+
+	recMask, dupMask, trailMask := uint64(l.Uint32(buf[14:])), int(buf[18]), int(buf[19])
+	dupBits, trailBits, infoLen := uint(buf[21]), uint(buf[22]), int(buf[23])
+	if infoLen < 1 || infoLen > 8 || dupBits+trailBits > uint(8*infoLen) {
+		return nil, fmt.Errorf("invalid leaf entry of %d bytes with %d and %d bit counts",
+			infoLen, dupBits, trailBits)
+	}
+	keys := buf[24:]
+	end := len(keys) // keys are stored from the end of the node
+	prev := make([]byte, x.keyLen)
+	for i := 0; i < n; i++ {
+		if (i+1)*infoLen > end {
+			return nil, fmt.Errorf("leaf entry %d overlaps the keys", i)
+		}
+		var v uint64
+		for j := infoLen - 1; j >= 0; j-- {
+			v = v<<8 | uint64(keys[i*infoLen+j])
+		}
+		bits := uint(8 * infoLen)
+		dup := int(v>>(bits-trailBits-dupBits)) & dupMask
+		trail := int(v>>(bits-trailBits)) & trailMask
+		size := x.keyLen - dup - trail
+		if size < 0 || end-size < (i+1)*infoLen {
+			return nil, fmt.Errorf("leaf entry %d: invalid key of %d bytes after %d shared and %d trailing",
+				i, x.keyLen, dup, trail)
+		}
+		end -= size
+		key := make([]byte, x.keyLen)
+		copy(key, prev[:dup])
+		copy(key[dup:], keys[end:end+size])
+		for j := dup + size; j < x.keyLen; j++ {
+			key[j] = pad
+		}
+		node.keys = append(node.keys, string(key))
+		node.ptrs = append(node.ptrs, int64(v&recMask))
+		prev = key
+	}
+	return node, nil
+}
+
+// readIndex reads n bytes of an index file at offset.
+func readIndex(r io.ReaderAt, offset int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if nr, err := r.ReadAt(buf, offset); nr < n {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// cString returns the text of buf up to its first zero byte.
+func cString(buf []byte) string {
+	if i := strings.IndexByte(string(buf), 0); i >= 0 {
+		buf = buf[:i]
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// mdxNumber decodes a 12 byte number of a .mdx key: an exponent biased
+// by 0x34, a byte with the sign and the number of digits, and up to 20
+// binary coded decimal digits.
+func mdxNumber(raw []byte) float64 {
+	n := min(int(raw[1]>>2)&0x1f, 20)
+	var v float64
+	for i := 0; i < n; i++ {
+		d := raw[2+i/2]
+		if i%2 == 0 {
+			d >>= 4
+		}
+		v = v*10 + float64(d&0x0f)
+	}
+	v *= math.Pow10(int(raw[0]) - 0x34 - n)
+	if raw[1]&0x80 != 0 {
+		v = -v
+	}
+	return v
+}
+
+// julianDay returns the Julian day number of the date of t, which is how
+// index files store dates.
+func julianDay(t time.Time) float64 {
+	y, m, d := t.Date()
+	return float64(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix()/86400 + 2440588)
+}
+
+// HasProductionIndex reports whether the header says that a production
+// .mdx or .cdx index with the same base name goes with the file.
+func (dbf *DBFFile) HasProductionIndex() bool {
+	return dbf.DBFFileHeader.MDXFlag != 0
+}
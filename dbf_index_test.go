@@ -0,0 +1,232 @@
+package shapefile
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lookup is an index lookup and the records it should find.
+type lookup struct {
+	lo, hi interface{}
+	want   []int
+}
+
+func checkLookups(t *testing.T, x *DBFIndex, lookups []lookup) {
+	t.Helper()
+	for _, q := range lookups {
+		got, err := x.Range(q.lo, q.hi)
+		if err != nil {
+			t.Errorf("%s %v to %v: %v", x.Name, q.lo, q.hi, err)
+		} else if !reflect.DeepEqual(got, q.want) {
+			t.Errorf("%s %v to %v: got %v, want %v", x.Name, q.lo, q.hi, got, q.want)
+		}
+	}
+}
+
+func TestNDX(t *testing.T) {
+	buf := make([]byte, 4*512)
+	l.PutUint32(buf, 1)      // root
+	l.PutUint16(buf[12:], 4) // key length
+	l.PutUint16(buf[18:], 12)
+	copy(buf[24:], "NAME")
+	// root, then two leaves sharing the key BB
+	node := func(block int, keys []string, ptrs ...uint32) {
+		n := buf[block*512:]
+		l.PutUint32(n, uint32(len(keys)))
+		for i, p := range ptrs {
+			e := n[4+12*i:]
+			if block == 1 {
+				l.PutUint32(e, p)
+			} else {
+				l.PutUint32(e[4:], p)
+			}
+			if i < len(keys) {
+				copy(e[8:], keys[i])
+			}
+		}
+	}
+	node(1, []string{"BB  "}, 2, 3)
+	node(2, []string{"AAAA", "BB  "}, 3, 1)
+	node(3, []string{"BB  ", "CC  "}, 5, 2)
+
+	x, err := OpenNDX(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Expression != "NAME" || x.KeyType != Character {
+		t.Errorf("expression %q, key type %c", x.Expression, x.KeyType)
+	}
+	checkLookups(t, x, []lookup{
+		{"BB", "BB", []int{1, 5}},
+		{"AB", "BZ", []int{1, 5}},
+		{nil, "AAAA", []int{3}},
+		{"C", nil, []int{2}},
+		{nil, nil, []int{3, 1, 5, 2}},
+		{"ZZ", "ZZ", nil},
+	})
+	if _, err = x.Find(3); err == nil {
+		t.Errorf("no error for a numeric key")
+	}
+}
+
+func TestNDXFullNode(t *testing.T) {
+	// a root with as many keys as fit, and a leaf for each of its 43
+	// children
+	const n = (512 - 4 - 4) / 12
+	buf := make([]byte, (n+3)*512)
+	l.PutUint32(buf, 1)      // root
+	l.PutUint16(buf[12:], 4) // key length
+	l.PutUint16(buf[18:], 12)
+	copy(buf[24:], "NAME")
+	root := buf[512:]
+	l.PutUint32(root, n)
+	for i := 0; i <= n; i++ {
+		key := fmt.Sprintf("K%02d ", i)
+		l.PutUint32(root[4+12*i:], uint32(2+i))
+		if i < n {
+			copy(root[4+12*i+8:], key)
+		}
+		leaf := buf[(2+i)*512:]
+		l.PutUint32(leaf, 1)
+		l.PutUint32(leaf[8:], uint32(i+1))
+		copy(leaf[12:], key)
+	}
+
+	x, err := OpenNDX(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := make([]int, n+1)
+	for i := range all {
+		all[i] = i + 1
+	}
+	checkLookups(t, x, []lookup{
+		{"K10", "K12", []int{11, 12, 13}},
+		{"K42", nil, []int{43}},
+		{nil, nil, all},
+	})
+}
+
+func TestMDX(t *testing.T) {
+	buf := make([]byte, 3072)
+	l.PutUint16(buf[22:], 1024) // block size
+	buf[26] = 32                // tag length
+	l.PutUint16(buf[28:], 1)    // tags
+	tag := buf[544:]
+	l.PutUint32(tag, 2)
+	copy(tag[4:], "VALUE")
+	tag[20] = 'N'
+	th := buf[1024:]
+	l.PutUint32(th, 4) // root page
+	l.PutUint16(th[12:], 12)
+	l.PutUint16(th[18:], 16)
+	copy(th[24:], "VALUE")
+	leaf := buf[2048:]
+	l.PutUint32(leaf, 3)
+	for i, k := range [][]byte{{0x35, 0x84, 0x20}, {0x35, 0x04, 0x10}, {0x36, 0x0c, 0x12, 0x50}} {
+		e := leaf[8+16*i:]
+		l.PutUint32(e, []uint32{3, 1, 2}[i])
+		copy(e[4:], k)
+	}
+
+	idx, err := OpenMDX(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx) != 1 || idx[0].Name != "VALUE" || idx[0].KeyType != Number {
+		t.Fatalf("tags %+v", idx)
+	}
+	checkLookups(t, idx[0], []lookup{
+		{12.5, 12.5, []int{2}},
+		{0, 20, []int{1, 2}},
+		{nil, -2, []int{3}},
+	})
+
+	// four entries fill the node, leaving no room for the pointer that
+	// tells leaves from other nodes
+	l.PutUint16(th[18:], 254)
+	l.PutUint32(leaf, 4)
+	if idx, err = OpenMDX(bytes.NewReader(buf)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = idx[0].Range(nil, nil); err == nil {
+		t.Errorf("no error for a node without its last pointer")
+	}
+}
+
+// cdxLeaf returns a compressed .cdx leaf of keys, with 3 byte entries:
+// 16 bits of record number and 4 bits each of shared and trailing bytes.
+func cdxLeaf(attr uint16, keyLen int, pad byte, keys []string, recs []uint32) []byte {
+	node := make([]byte, 512)
+	l.PutUint16(node, attr)
+	l.PutUint16(node[2:], uint16(len(keys)))
+	l.PutUint32(node[14:], 0xffff)
+	node[18], node[19] = 0x0f, 0x0f
+	node[20], node[21], node[22], node[23] = 16, 4, 4, 3
+	area, end, prev := node[24:], 512-24, ""
+	for i, k := range keys {
+		trail := len(k) - len(strings.TrimRight(k, string(pad)))
+		dup := 0
+		for dup < len(prev) && dup < keyLen-trail && prev[dup] == k[dup] {
+			dup++
+		}
+		stored := k[dup : keyLen-trail]
+		end -= len(stored)
+		copy(area[end:], stored)
+		v := recs[i] | uint32(dup)<<16 | uint32(trail)<<20
+		area[3*i], area[3*i+1], area[3*i+2] = byte(v), byte(v>>8), byte(v>>16)
+		prev = k
+	}
+	return node
+}
+
+func TestCDX(t *testing.T) {
+	buf := make([]byte, 5632)
+	header := func(offset int, root uint32, keyLen int, expr string) {
+		l.PutUint32(buf[offset:], root)
+		l.PutUint16(buf[offset+12:], uint16(keyLen))
+		copy(buf[offset+512:], expr)
+	}
+	num := func(f float64) string {
+		k, _, _ := (&DBFIndex{kind: KindCdx, keyLen: 8}).searchKey(f)
+		return k.s
+	}
+
+	header(0, 1024, 10, "")
+	copy(buf[1024:], cdxLeaf(3, 10, ' ', []string{"APN       ", "AREA      "}, []uint32{1536, 3072}))
+	header(1536, 2560, 6, "APN")
+	copy(buf[2560:], cdxLeaf(3, 6, ' ', []string{"A1    ", "A12   ", "A12   ", "B7    "}, []uint32{4, 1, 3, 2}))
+	header(3072, 4096, 8, "AREA")
+	root := buf[4096:]
+	l.PutUint16(root, 1)
+	l.PutUint16(root[2:], 2)
+	for i, k := range []string{num(2.5), num(10)} {
+		e := root[12+16*i:]
+		copy(e, k)
+		b.PutUint32(e[12:], uint32(4608+512*i))
+	}
+	copy(buf[4608:], cdxLeaf(2, 8, 0, []string{num(-3), num(1), num(2.5)}, []uint32{6, 4, 2}))
+	copy(buf[5120:], cdxLeaf(2, 8, 0, []string{num(2.5), num(10)}, []uint32{7, 1}))
+
+	idx, err := OpenCDX(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx) != 2 || idx[0].Name != "APN" || idx[1].Name != "AREA" || idx[1].Expression != "AREA" {
+		t.Fatalf("tags %+v", idx)
+	}
+	checkLookups(t, idx[0], []lookup{
+		{"A12", "A12", []int{1, 3}},
+		{"A1", "A2", []int{4, 1, 3}},
+		{"B", nil, []int{2}},
+	})
+	checkLookups(t, idx[1], []lookup{
+		{2.5, 2.5, []int{2, 7}},
+		{0, 5, []int{4, 2, 7}},
+		{nil, 0, []int{6}},
+		{nil, nil, []int{6, 4, 2, 7, 1}},
+	})
+}
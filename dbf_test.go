@@ -1,6 +1,7 @@
 package shapefile
 
 import (
+	"io"
 	"os"
 	"testing"
 )
@@ -15,7 +16,7 @@ func TestDBFSimple2(t *testing.T) {
 	if err != nil {
 		t.Errorf("Failed opening file: %s", err.Error())
 	}
-	_, err = NewDBFFile(file)
+	_, err = OpenDBFFile(file)
 
 	if err != nil {
 		t.Error(err)
@@ -25,7 +26,7 @@ func TestDBFSimple2(t *testing.T) {
 func TestDBFHeadSimple(t *testing.T) {
 	file, _ := os.Open(dbf_test_fn)
 	defer file.Close()
-	hdr, err := NewDBFFileHeader(file)
+	hdr, err := newDBFFileHeader(file)
 
 	if err != nil {
 		t.Fail()
@@ -41,23 +42,32 @@ func TestDBFHeadSimple(t *testing.T) {
 func TestDBFSimple(t *testing.T) {
 	file, _ := os.Open(dbf_test_fn)
 	defer file.Close()
-	f, err := NewDBFFile(file)
+	f, err := OpenDBFFile(file)
 
 	if err != nil {
-		t.Errorf(err.Error())
+		t.Fatal(err)
 	}
 	if 4 != len(f.FieldDescriptors) {
 		t.Errorf("fielddesc len != 4")
 	}
-	if f.FieldDescriptors[0].FieldName() != "WKR_NR" {
+	if f.FieldDescriptors[0].fieldName() != "WKR_NR" {
 		t.Errorf("fieldname 0 not WKR_NR")
 	}
-	if f.FieldDescriptors[3].FieldName() != "LAND_NAME" {
+	if f.FieldDescriptors[3].fieldName() != "LAND_NAME" {
 		t.Errorf("fieldname 3 not LAND_NAME")
 	}
 
-	if 299 != len(f.Entries) {
-		t.Errorf("incorrect number of entries: %d", len(f.Entries))
+	n := 0
+	for {
+		if _, err = f.NextRecord(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if 299 != n {
+		t.Errorf("incorrect number of entries: %d", n)
 	}
 
 	//	for _, fd := range f.FieldDescriptors {
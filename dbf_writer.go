@@ -0,0 +1,183 @@
+package shapefile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// NewFieldDescriptor returns the descriptor of a DBF field. Names longer
+// than 10 bytes are truncated. Character fields may be up to 65535 bytes
+// long; beyond 255 the high byte of the length is kept in DecimalCount,
+// as Clipper and FoxPro do. Other fields are at most 255 bytes long.
+// Longer lengths are cut to the limit.
+func NewFieldDescriptor(name string, t FieldType, length, decimals int) FieldDescriptor {
+	var fd FieldDescriptor
+	if len(name) > 10 {
+		name = name[:10]
+	}
+	copy(fd.FieldName_[:], name)
+	fd.FieldType = t
+	fd.DecimalCount = uint8(decimals)
+	fd.setWidth(length)
+	return fd
+}
+
+// DBFWriter writes rows to a .dbf file. Rows are streamed as they are
+// written; the record count in the header is filled in by Close.
+type DBFWriter struct {
+	DBFFileHeader    *DBFFileHeader
+	FieldDescriptors []FieldDescriptor
+	w                io.WriteSeeker
+	bw               *bufio.Writer
+	buf              []byte
+}
+
+// NewDBFWriter creates a writer for rows with the given fields.
+func NewDBFWriter(w io.WriteSeeker, fields []FieldDescriptor) (dbf *DBFWriter, err error) {
+	dbf = &DBFWriter{w: w, FieldDescriptors: fields}
+	dbf.bw = bufio.NewWriter(w)
+	now := time.Now()
+	hdr := &DBFFileHeader{Version: 3}
+	hdr.LastUpdate = [3]uint8{uint8(now.Year() - 1900), uint8(now.Month()),
+		uint8(now.Day())}
+	hdr.LenHeader = uint16(32 + 32*len(fields) + 1)
+	hdr.LenRecord = 1
+	for _, fd := range fields {
+		hdr.LenRecord += uint16(fd.Width())
+	}
+	dbf.DBFFileHeader = hdr
+	if err = dbf.writeHeader(dbf.bw); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (dbf *DBFWriter) writeHeader(w io.Writer) (err error) {
+	if err = binary.Write(w, l, dbf.DBFFileHeader); err != nil {
+		return
+	}
+	for i := range dbf.FieldDescriptors {
+		if err = binary.Write(w, l, &dbf.FieldDescriptors[i]); err != nil {
+			return
+		}
+	}
+	_, err = w.Write([]byte{0x0d})
+	return
+}
+
+// Write appends a row. Values are matched to fields by position; nil
+// values are written as blanks.
+func (dbf *DBFWriter) Write(entry []interface{}) error {
+	if len(entry) != len(dbf.FieldDescriptors) {
+		return fmt.Errorf("expected %d values, got: %d",
+			len(dbf.FieldDescriptors), len(entry))
+	}
+	dbf.buf = append(dbf.buf[:0], ' ')
+	for i, fd := range dbf.FieldDescriptors {
+		s, err := formatField(&fd, entry[i])
+		if err != nil {
+			return fmt.Errorf("field %s: %v", fd.fieldName(), err)
+		}
+		width := fd.Width()
+		pad := strings.Repeat(" ", width-len(s))
+		switch fd.FieldType {
+		case Character, Logical, Date:
+			dbf.buf = append(dbf.buf, s...)
+			dbf.buf = append(dbf.buf, pad...)
+		default:
+			dbf.buf = append(dbf.buf, pad...)
+			dbf.buf = append(dbf.buf, s...)
+		}
+	}
+	if _, err := dbf.bw.Write(dbf.buf); err != nil {
+		return err
+	}
+	dbf.DBFFileHeader.NumRecords++
+	return nil
+}
+
+// formatField returns the text of v for field fd, which is never longer
+// than the field.
+func formatField(fd *FieldDescriptor, v interface{}) (s string, err error) {
+	width := fd.Width()
+	switch val := v.(type) {
+	case nil, error:
+		return "", nil
+	case string:
+		s = val
+	case bool:
+		s = "F"
+		if val {
+			s = "T"
+		}
+	case time.Time:
+		s = val.Format("20060102")
+	case int:
+		s = strconv.Itoa(val)
+	case int32:
+		s = strconv.FormatInt(int64(val), 10)
+	case int64:
+		s = strconv.FormatInt(val, 10)
+	case float32:
+		return formatFloat(fd, float64(val))
+	case float64:
+		return formatFloat(fd, val)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if len(s) > width {
+		if fd.FieldType == Character {
+			// cut at the start of a character
+			for width > 0 && !utf8.RuneStart(s[width]) {
+				width--
+			}
+			return s[:width], nil
+		}
+		return "", fmt.Errorf("value %q is wider than %d", s, width)
+	}
+	return s, nil
+}
+
+func formatFloat(fd *FieldDescriptor, v float64) (string, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", nil
+	}
+	s := strconv.FormatFloat(v, 'f', int(fd.DecimalCount), 64)
+	if fd.FieldType == Character {
+		s = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	if len(s) > fd.Width() {
+		// fall back to exponent notation rather than losing the value
+		s = strconv.FormatFloat(v, 'e', -1, 64)
+		if len(s) > fd.Width() {
+			return "", fmt.Errorf("value %v is wider than %d", v, fd.Width())
+		}
+	}
+	return s, nil
+}
+
+// Close flushes the remaining rows and writes the final header. It does
+// not close the underlying writer.
+func (dbf *DBFWriter) Close() (err error) {
+	if _, err = dbf.bw.Write([]byte{0x1a}); err != nil {
+		return
+	}
+	if err = dbf.bw.Flush(); err != nil {
+		return
+	}
+	if _, err = dbf.w.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if err = binary.Write(dbf.w, l, dbf.DBFFileHeader); err != nil {
+		return
+	}
+	_, err = dbf.w.Seek(0, io.SeekEnd)
+	return
+}
@@ -0,0 +1,181 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ctessum/geomop"
+	"github.com/twpayne/gogeom/geom"
+)
+
+// DissolveOptions configures Dissolve.
+type DissolveOptions struct {
+	// By lists the fields whose values identify a group. If empty, all
+	// features are dissolved into one.
+	By []string
+	// Aggregations summarize the other fields over each group.
+	Aggregations []FieldAggregation
+	// MinArea removes outer rings smaller than this, together with their
+	// holes, and fills holes smaller than this.
+	MinArea float64
+	// FillHoles removes all holes.
+	FillHoles bool
+}
+
+// Dissolve merges the polygons of layer that share the values of the
+// opts.By fields into one feature per group, in order of first
+// appearance. Values match if they are equal and of the same type, so
+// the number 1 and the string "1" form different groups; blank numbers
+// match each other. The output carries the By fields followed by the
+// aggregated fields. Its shapes are 2D polygons: Z and M values of the
+// input are dropped.
+func Dissolve(layer *Layer, opts DissolveOptions) (out *Layer, err error) {
+	out = &Layer{Type: POLYGON}
+	used := make(map[string]bool)
+	keys := make([]int, len(opts.By))
+	for i, name := range opts.By {
+		if keys[i] = layer.FieldIndex(name); keys[i] < 0 {
+			return nil, fmt.Errorf("layer has no field %s", name)
+		}
+		fd := layer.Fields[keys[i]]
+		out.Fields = append(out.Fields, renameField(fd, uniqueFieldName(name, used)))
+	}
+	var fields []FieldDescriptor
+	var aggCols []int
+	if fields, aggCols, err = aggregateFields(layer, opts.Aggregations, used); err != nil {
+		return nil, err
+	}
+	out.Fields = append(out.Fields, fields...)
+
+	// group the records by key, bucketed by the first key value
+	var groups []dissolveGroup
+	buckets := make(map[interface{}][]int)
+	for i, rec := range layer.Records {
+		if rec.Geometry == nil {
+			continue
+		}
+		if !isPolygonal(rec.Geometry) {
+			return nil, fmt.Errorf("record %d is not a polygon", i+1)
+		}
+		key := make([]interface{}, len(keys))
+		for k, col := range keys {
+			if layer.Rows[i] != nil {
+				key[k] = groupValue(layer.Rows[i][col])
+			}
+		}
+		var first interface{}
+		if len(key) > 0 {
+			first = key[0]
+		}
+		g := -1
+		for _, j := range buckets[first] {
+			if sameKey(groups[j].key, key) {
+				g = j
+				break
+			}
+		}
+		if g < 0 {
+			g = len(groups)
+			groups = append(groups, dissolveGroup{key: key})
+			buckets[first] = append(buckets[first], g)
+		}
+		groups[g].members = append(groups[g].members, i)
+	}
+
+	for _, group := range groups {
+		members := group.members
+		var g geom.T = flatPolygon(layer.Records[members[0]].Geometry)
+		for _, m := range members[1:] {
+			if g, err = geomop.Construct(g,
+				flatPolygon(layer.Records[m].Geometry), geomop.UNION); err != nil {
+				return nil, fmt.Errorf("dissolving record %d: %v", m+1, err)
+			}
+		}
+		pg := cleanPolygon(geomParts(g), opts.MinArea, opts.FillHoles)
+		var row []interface{}
+		first := layer.Rows[members[0]]
+		for _, col := range keys {
+			if first == nil {
+				row = append(row, nil)
+			} else {
+				row = append(row, first[col])
+			}
+		}
+		for j, a := range opts.Aggregations {
+			row = append(row, aggregate(a.Aggregation, layer.Rows, members, aggCols[j]))
+		}
+		out.add(&ShapefileRecord{Type: POLYGON, Geometry: pg, Bounds: geomBounds(pg)}, row)
+	}
+	return out, nil
+}
+
+// dissolveGroup is a set of records with the same key values.
+type dissolveGroup struct {
+	key     []interface{}
+	members []int
+}
+
+// blankNumber stands for NaN in group keys, which would otherwise
+// never equal itself.
+type blankNumber struct{}
+
+// groupValue returns v as a group key value.
+func groupValue(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && math.IsNaN(f) {
+		return blankNumber{}
+	}
+	return v
+}
+
+// sameKey reports whether two group keys hold equal values.
+func sameKey(a, b []interface{}) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanPolygon drops outer rings smaller than minArea together with
+// their holes, and holes that are smaller than minArea or, if
+// fillHoles is set, all holes.
+func cleanPolygon(rings [][]geom.Point, minArea float64, fillHoles bool) geom.Polygon {
+	holes := make([]bool, len(rings))
+	areas := make([]float64, len(rings))
+	for i, r := range rings {
+		holes[i] = ringIsHole(rings, i)
+		areas[i] = math.Abs(signedArea(r))
+	}
+	keep := make([]bool, len(rings))
+	for i := range rings {
+		keep[i] = areas[i] > 0 && areas[i] >= minArea
+	}
+	for i, r := range rings {
+		if !holes[i] || !keep[i] {
+			continue
+		}
+		if fillHoles {
+			keep[i] = false
+			continue
+		}
+		// a hole goes with the smallest outer ring around it
+		owner := -1
+		for j := range rings {
+			if holes[j] || len(r) == 0 || !pointInRings(r[0], rings[j:j+1]) {
+				continue
+			}
+			if owner < 0 || areas[j] < areas[owner] {
+				owner = j
+			}
+		}
+		keep[i] = owner >= 0 && keep[owner]
+	}
+	var pg geom.Polygon
+	for i, r := range rings {
+		if keep[i] {
+			pg.Rings = append(pg.Rings, r)
+		}
+	}
+	return pg
+}
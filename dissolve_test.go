@@ -0,0 +1,100 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+func TestDissolve(t *testing.T) {
+	layer := &Layer{
+		Type: POLYGON,
+		Fields: []FieldDescriptor{
+			NewFieldDescriptor("KEY", Character, 4, 0),
+			NewFieldDescriptor("POP", Number, 4, 0),
+		},
+	}
+	var z geom.PolygonZ
+	for _, r := range square(10, 0, 1).Rings {
+		var ring []geom.PointZ
+		for _, p := range r {
+			ring = append(ring, geom.PointZ{X: p.X, Y: p.Y, Z: 7})
+		}
+		z.Rings = append(z.Rings, ring)
+	}
+	layer.add(&ShapefileRecord{Geometry: square(0, 0, 1)}, []interface{}{1, 10})
+	layer.add(&ShapefileRecord{Geometry: square(5, 0, 1)}, []interface{}{"1", 20})
+	layer.add(&ShapefileRecord{Geometry: z}, []interface{}{math.NaN(), 30})
+	layer.add(&ShapefileRecord{Geometry: square(1, 0, 1)}, []interface{}{1, 40})
+	layer.add(&ShapefileRecord{}, []interface{}{1, 50})
+	layer.add(&ShapefileRecord{Geometry: square(12, 0, 1)}, []interface{}{math.NaN(), 60})
+
+	out, err := Dissolve(layer, DissolveOptions{
+		By:           []string{"KEY"},
+		Aggregations: []FieldAggregation{{Field: "POP", Aggregation: AggSum}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i, rec := range out.Records {
+		if _, ok := rec.Geometry.(geom.Polygon); !ok {
+			t.Errorf("group %d: geometry %T", i, rec.Geometry)
+		}
+		area, parts := shapeOf(rec.Geometry)
+		got = append(got, fmt.Sprintf("%#v %v %g %d", out.Rows[i][0], out.Rows[i][1], area, parts))
+	}
+	// the number 1 and the string "1" are different keys, blank numbers
+	// are the same
+	want := []string{"1 50 2 1", `"1" 20 1 1`, "NaN 90 2 2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	writeTestLayer(t, out)
+
+	out, err = Dissolve(layer, DissolveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Records) != 1 || len(out.Fields) != 0 {
+		t.Errorf("%d features with %d fields, want everything in one", len(out.Records), len(out.Fields))
+	} else if area, parts := shapeOf(out.Records[0].Geometry); area != 5 || parts != 4 {
+		t.Errorf("area %g in %d parts, want 5 in 4", area, parts)
+	}
+
+	if _, err = Dissolve(layer, DissolveOptions{By: []string{"NONE"}}); err == nil {
+		t.Errorf("no error for an unknown field")
+	}
+}
+
+func TestCleanPolygon(t *testing.T) {
+	hole := square(1, 1, 1).Rings[0]
+	for i, j := 0, len(hole)-1; i < j; i, j = i+1, j-1 {
+		hole[i], hole[j] = hole[j], hole[i]
+	}
+	rings := [][]geom.Point{
+		square(0, 0, 4).Rings[0], hole,
+		square(10, 0, 0.5).Rings[0], // small island
+	}
+	tests := []struct {
+		minArea   float64
+		fillHoles bool
+		area      float64
+		parts     int
+	}{
+		{0, false, 15.25, 2},
+		{0.5, false, 15, 1},
+		{2, false, 16, 1},
+		{0, true, 16.25, 2},
+	}
+	for _, test := range tests {
+		pg := cleanPolygon(rings, test.minArea, test.fillHoles)
+		if area, parts := shapeOf(pg); area != test.area || parts != test.parts {
+			t.Errorf("min area %g, fill holes %v: area %g in %d parts, want %g in %d",
+				test.minArea, test.fillHoles, area, parts, test.area, test.parts)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package shapefile
+
+import "fmt"
+
+// LengthError reports a count or length field whose value does not fit
+// the data that holds it.
+type LengthError struct {
+	Field string // name of the field, as in the format specification
+	Value int64
+	Min   int64 // smallest value the surrounding data allows
+	Max   int64 // largest value the surrounding data allows
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("invalid %s: %d (want %d to %d)", e.Field, e.Value, e.Min, e.Max)
+}
+
+// PartError reports a part index that is negative, smaller than the one
+// before it, or past the last point of the record.
+type PartError struct {
+	Part      int   // position in the parts array
+	Index     int32 // index of the first point of the part
+	NumPoints int32
+}
+
+func (e *PartError) Error() string {
+	return fmt.Sprintf("invalid index of part %d: %d (%d points)",
+		e.Part, e.Index, e.NumPoints)
+}
+
+// FileKind identifies a file of a shapefile set, or an index of its
+// .dbf file, in errors.
+type FileKind string
+
+const (
+	KindShp FileKind = "shp"
+	KindShx FileKind = "shx"
+	KindDbf FileKind = "dbf"
+	KindNdx FileKind = "ndx"
+	KindMdx FileKind = "mdx"
+	KindCdx FileKind = "cdx"
+)
+
+// HeaderError reports a problem with the header of a file. Field is the
+// header field at fault, or empty if it is not known.
+type HeaderError struct {
+	Kind   FileKind
+	Field  string
+	Offset int64 // byte offset of the field, or of the header
+	Err    error
+}
+
+func (e *HeaderError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s header, byte %d: %v", e.Kind, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%s header, %s at byte %d: %v", e.Kind, e.Field, e.Offset, e.Err)
+}
+
+func (e *HeaderError) Unwrap() error { return e.Err }
+
+// RecordError reports a problem with a record of a .shp or .shx file or
+// a row of a .dbf file.
+type RecordError struct {
+	Kind   FileKind
+	Record int   // record number, counting from one
+	Offset int64 // byte offset of the record
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("%s record %d at byte %d: %v", e.Kind, e.Record, e.Offset, e.Err)
+}
+
+func (e *RecordError) Unwrap() error { return e.Err }
+
+// FieldError reports a value of a .dbf file that cannot be decoded.
+type FieldError struct {
+	Record int // row, counting from one
+	Field  string
+	Offset int64 // byte offset of the value
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("dbf record %d, field %s at byte %d: %v",
+		e.Record, e.Field, e.Offset, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
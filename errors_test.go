@@ -0,0 +1,126 @@
+package shapefile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestRecordError(t *testing.T) {
+	data, err := os.ReadFile(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenShapefile(bytes.NewReader(data[:200]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.NextRecord()
+	var rerr *RecordError
+	if !errors.As(err, &rerr) || rerr.Kind != KindShp || rerr.Record != 1 || rerr.Offset != 100 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("cause not wrapped: %v", err)
+	}
+
+	// break the shape type of the second record
+	s, _ = OpenShapefile(bytes.NewReader(data))
+	rec, _ := s.NextRecord()
+	off := 100 + 8 + 2*int(rec.header.ContentLength)
+	data = append([]byte(nil), data...)
+	l.PutUint32(data[off+8:], 7)
+	s, _ = OpenShapefile(bytes.NewReader(data))
+	s.NextRecord()
+	_, err = s.NextRecord()
+	if !errors.As(err, &rerr) || rerr.Record != 2 || rerr.Offset != int64(off) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestHeaderError(t *testing.T) {
+	file, _ := os.Open(testfileInv)
+	defer file.Close()
+	_, err := OpenShapefile(file)
+	var herr *HeaderError
+	if !errors.As(err, &herr) || herr.Field != "FileCode" || herr.Offset != 0 {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestFieldError(t *testing.T) {
+	buf := new(memFile)
+	dbf, err := NewDBFWriter(buf, []FieldDescriptor{
+		NewFieldDescriptor("NAME", Character, 4, 0),
+		NewFieldDescriptor("POP", Number, 6, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{{"a", 1}, {"b", "x"}} {
+		if err = dbf.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenDBFFile(buf.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.NextRecord()
+	row, err := r.NextRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ferr *FieldError
+	if verr, ok := row[1].(error); !ok || !errors.As(verr, &ferr) {
+		t.Fatalf("unexpected value %v", row[1])
+	}
+	// header, two descriptors, terminator, first row, deletion flag, NAME
+	if want := int64(32+2*32+1) + 11 + 1 + 4; ferr.Record != 2 || ferr.Field != "POP" || ferr.Offset != want {
+		t.Errorf("error %v, want offset %d", ferr, want)
+	}
+}
+
+func TestFieldErrorValues(t *testing.T) {
+	buf := new(memFile)
+	fields := []FieldDescriptor{
+		NewFieldDescriptor("OK", Logical, 1, 0),
+		NewFieldDescriptor("MEMO", Character, 10, 0),
+	}
+	dbf, err := NewDBFWriter(buf, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{{"x", "1"}, {nil, "2"}} {
+		if err = dbf.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = dbf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf.buf[32+32+11] = Memo // FieldType of the second field
+	r, err := OpenDBFFile(buf.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := r.NextRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"OK", "MEMO"} {
+		var ferr *FieldError
+		if verr, ok := row[i].(error); !ok || !errors.As(verr, &ferr) || ferr.Field != name {
+			t.Errorf("field %s: unexpected value %v", name, row[i])
+		}
+	}
+	// blank logical fields are not initialized
+	if row, err = r.NextRecord(); err != nil || row[0] != nil {
+		t.Errorf("blank logical: got %v, %v", row, err)
+	}
+}
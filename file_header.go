@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+
+	"github.com/twpayne/gogeom/geom"
 )
 
 type ShapefileHeader struct {
@@ -22,6 +24,47 @@ type ShapefileHeader struct {
 	Mmax       float64
 }
 
+// Range is an interval of Z or M values.
+type Range struct {
+	Min, Max float64
+}
+
+// Contains reports whether v lies in r.
+func (r *Range) Contains(v float64) bool {
+	return r.Min <= v && v <= r.Max
+}
+
+// Overlaps reports whether r and o share any value.
+func (r *Range) Overlaps(o *Range) bool {
+	return r.Min <= o.Max && o.Min <= r.Max
+}
+
+// Bounds returns the XY extent of the file.
+func (h *ShapefileHeader) Bounds() *geom.Bounds {
+	return &geom.Bounds{
+		Min: geom.Point{X: h.Xmin, Y: h.Ymin},
+		Max: geom.Point{X: h.Xmax, Y: h.Ymax},
+	}
+}
+
+// ZRange returns the range of Z values of the file, or nil if its shape
+// type has no Z values.
+func (h *ShapefileHeader) ZRange() *Range {
+	if !h.ShapeType.hasZ() {
+		return nil
+	}
+	return &Range{Min: h.Zmin, Max: h.Zmax}
+}
+
+// MRange returns the range of M values of the file, or nil if its shape
+// type has no M values or they are all "no data".
+func (h *ShapefileHeader) MRange() *Range {
+	if !h.ShapeType.hasM() {
+		return nil
+	}
+	return mRange(h.Mmin, h.Mmax)
+}
+
 func (h *ShapefileHeader) String() string {
 	str := fmt.Sprintf("FileLength %d\n", h.FileLength)
 	str += fmt.Sprintf("Version %d\n", h.Version)
@@ -102,71 +145,63 @@ func (h *shapefileRecordHeader) String() string {
 	return str
 }
 
-func newShapefileHeaderFromReader(r io.Reader) (hdr *ShapefileHeader, err error) {
+// newShapefileHeaderFromReader reads the header of a .shp or .shx file.
+// Errors are *HeaderError.
+func newShapefileHeaderFromReader(r io.Reader, kind FileKind) (hdr *ShapefileHeader, err error) {
+	fail := func(field string, off int64, err error) (*ShapefileHeader, error) {
+		return nil, &HeaderError{Kind: kind, Field: field, Offset: off, Err: err}
+	}
 
 	var fileCode int32
 	if err = binary.Read(r, binary.BigEndian, &fileCode); err != nil {
-		return
+		return fail("FileCode", 0, err)
 	}
 	if fileCode != 9994 {
-		return nil, fmt.Errorf("invalid fileCode: %d", fileCode)
+		return fail("FileCode", 0, fmt.Errorf("invalid fileCode: %d", fileCode))
 	}
 	unused := make([]byte, 20)
 	var n int
 	if n, err = r.Read(unused); err != nil {
-		return
+		return fail("Unused", 4, err)
 	} else if n != 20 {
-		return nil, fmt.Errorf("can't read UNUSED")
+		return fail("Unused", 4, fmt.Errorf("can't read UNUSED"))
 	}
 
 	hdr = &ShapefileHeader{}
 	if err = binary.Read(r, binary.BigEndian, &hdr.FileLength); err != nil {
-		return
+		return fail("FileLength", 24, err)
 	}
 	if err = binary.Read(r, binary.LittleEndian, &hdr.Version); err != nil {
-		return
+		return fail("Version", 28, err)
 	}
 	if hdr.Version != 1000 {
-		return nil, fmt.Errorf("Version must be 1000, is: %d", hdr.Version)
-	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.ShapeType); err != nil {
-		return
-	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.Xmin); err != nil {
-		return
-	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.Ymin); err != nil {
-		return
-	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.Xmax); err != nil {
-		return
-	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.Ymax); err != nil {
-		return
-	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.Zmin); err != nil {
-		return
+		return fail("Version", 28, fmt.Errorf("Version must be 1000, is: %d", hdr.Version))
+	}
+	off := int64(32)
+	for _, f := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"ShapeType", &hdr.ShapeType},
+		{"Xmin", &hdr.Xmin}, {"Ymin", &hdr.Ymin},
+		{"Xmax", &hdr.Xmax}, {"Ymax", &hdr.Ymax},
+		{"Zmin", &hdr.Zmin}, {"Zmax", &hdr.Zmax},
+		{"Mmin", &hdr.Mmin}, {"Mmax", &hdr.Mmax},
+	} {
+		if err = binary.Read(r, binary.LittleEndian, f.v); err != nil {
+			return fail(f.name, off, err)
+		}
+		off += int64(binary.Size(f.v))
 	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.Zmax); err != nil {
-		return
-	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.Mmin); err != nil {
-		return
-	}
-	if err = binary.Read(r, binary.LittleEndian, &hdr.Mmax); err != nil {
-		return
-	}
-
 	return
 }
 
-func newShapefileRecordHeaderFromReader(r io.Reader) (hdr *shapefileRecordHeader, err error) {
-	hdr = new(shapefileRecordHeader)
-	if err = binary.Read(r, binary.BigEndian, &hdr.RecordNumber); err != nil {
-		return
-	}
-	if err = binary.Read(r, binary.BigEndian, &hdr.ContentLength); err != nil {
+func newShapefileRecordHeaderFromReader(r io.Reader, buf []byte) (hdr *shapefileRecordHeader, err error) {
+	if _, err = io.ReadFull(r, buf[:8]); err != nil {
 		return
 	}
+	hdr = new(shapefileRecordHeader)
+	hdr.RecordNumber = int32(binary.BigEndian.Uint32(buf[0:]))
+	hdr.ContentLength = int32(binary.BigEndian.Uint32(buf[4:]))
 	return
 }
@@ -2,6 +2,7 @@ package shapefile
 
 import (
 	"encoding/binary"
+	"io"
 	"os"
 	"testing"
 )
@@ -13,7 +14,7 @@ const testfileInv = "test/invalidhdr.shp"
 func TestMainFileHeaderRead(t *testing.T) {
 	file, _ := os.Open(testfile)
 	defer file.Close()
-	hdr, _ := NewMainFileHeaderFromReader(file)
+	hdr, _ := newShapefileHeaderFromReader(file, KindShp)
 	expected := `FileLength 152120
 Version 1000
 ShapeType POLYGON
@@ -34,8 +35,8 @@ Mmax 0.00
 func TestMainFileHeaderReadNotEnough(t *testing.T) {
 	file, _ := os.Open(testfileTrunc)
 	defer file.Close()
-	_, err := NewMainFileHeaderFromReader(file)
-	if "can't read UNUSED" != err.Error() {
+	_, err := newShapefileHeaderFromReader(file, KindShp)
+	if "shp header, Unused at byte 4: can't read UNUSED" != err.Error() {
 		t.Fail()
 	}
 
@@ -43,8 +44,8 @@ func TestMainFileHeaderReadNotEnough(t *testing.T) {
 func TestMainFileHeaderReadInvalid(t *testing.T) {
 	file, _ := os.Open(testfileInv)
 	defer file.Close()
-	_, err := NewMainFileHeaderFromReader(file)
-	if "invalid fileCode: 654966784" != err.Error() {
+	_, err := newShapefileHeaderFromReader(file, KindShp)
+	if "shp header, FileCode at byte 0: invalid fileCode: 654966784" != err.Error() {
 		t.Fail()
 	}
 }
@@ -77,8 +78,20 @@ func TestBinaryTesting(t *testing.T) {
 func TestLoadShapefile(t *testing.T) {
 	file, _ := os.Open(testfile)
 	defer file.Close()
-	s, _ := NewShapefile(file)
-	if 299 != len(s.Records) {
-		t.Fail()
+	s, err := OpenShapefile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for {
+		if _, err = s.NextRecord(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if 299 != n {
+		t.Errorf("read %d records", n)
 	}
 }
@@ -0,0 +1,150 @@
+package shapefile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/ctessum/geomop"
+	"github.com/twpayne/gogeom/geom"
+)
+
+// FishnetOptions configures WriteFishnet.
+type FishnetOptions struct {
+	// Extent is covered by cells of size Dx by Dy starting at its lower
+	// left corner. The last row and column may extend past it.
+	Extent geom.Bounds
+	Dx, Dy float64
+	// Prj is the content of the .prj file written by CreateFishnet.
+	// No .prj file is written if it is empty.
+	Prj string
+	// If Mask is set, cells are clipped to its polygons, and cells that
+	// do not overlap it are left out.
+	Mask *Layer
+}
+
+// WriteFishnet writes a grid of rectangular polygons to a new shapefile.
+// Each cell carries its ROW and COL, counted from the lower left, and a
+// sequential ID. Cells are written as they are generated, so the size of
+// the grid is not limited by memory. It returns the number of cells
+// written.
+func WriteFishnet(shp, shx, dbf io.WriteSeeker, opts FishnetOptions) (n int, err error) {
+	if opts.Dx <= 0 || opts.Dy <= 0 {
+		return 0, fmt.Errorf("invalid cell size: %g x %g", opts.Dx, opts.Dy)
+	}
+	ext := opts.Extent
+	nx := int(math.Ceil((ext.Max.X - ext.Min.X) / opts.Dx))
+	ny := int(math.Ceil((ext.Max.Y - ext.Min.Y) / opts.Dy))
+	if nx <= 0 || ny <= 0 {
+		return 0, fmt.Errorf("empty extent: %v", ext)
+	}
+	grid := Grid{X0: ext.Min.X, Y0: ext.Min.Y, Dx: opts.Dx, Dy: opts.Dy,
+		Nx: nx, Ny: ny}
+
+	var sw *ShapefileWriter
+	if sw, err = NewShapefileWriter(shp, shx, POLYGON); err != nil {
+		return
+	}
+	var dw *DBFWriter
+	fields := []FieldDescriptor{
+		NewFieldDescriptor("ROW", Number, 10, 0),
+		NewFieldDescriptor("COL", Number, 10, 0),
+		NewFieldDescriptor("ID", Number, 19, 0),
+	}
+	if dw, err = NewDBFWriter(dbf, fields); err != nil {
+		return
+	}
+	var idx *gridIndex
+	if opts.Mask != nil {
+		idx = opts.Mask.index()
+	}
+	row := make([]interface{}, 3)
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			c := grid.cell(i, j)
+			var cell geom.T = geom.Polygon{Rings: [][]geom.Point{{
+				c.Min, {X: c.Max.X, Y: c.Min.Y}, c.Max,
+				{X: c.Min.X, Y: c.Max.Y}, c.Min,
+			}}}
+			if idx != nil {
+				if cell, err = clipToMask(cell, c, opts.Mask, idx); err != nil {
+					return n, fmt.Errorf("cell (%d, %d): %v", j, i, err)
+				} else if cell == nil {
+					continue
+				}
+			}
+			n++
+			if err = sw.Write(cell); err != nil {
+				return
+			}
+			row[0], row[1], row[2] = j, i, n
+			if err = dw.Write(row); err != nil {
+				return
+			}
+		}
+	}
+	if err = sw.Close(); err != nil {
+		return
+	}
+	err = dw.Close()
+	return
+}
+
+// clipToMask returns the part of cell inside the polygons of mask, or
+// nil if there is none. The parts clipped by neighbouring polygons are
+// merged, so a cell is only split where the mask leaves a gap.
+func clipToMask(cell geom.T, bounds *geom.Bounds, mask *Layer,
+	idx *gridIndex) (geom.T, error) {
+	var clip geom.T
+	var err error
+	idx.query(bounds, func(k int) {
+		g := mask.Records[k].Geometry
+		if err != nil || !isPolygonal(g) {
+			return
+		}
+		var piece geom.T
+		piece, err = geomop.Construct(cell, flatPolygon(g), geomop.INTERSECTION)
+		if err != nil || piece == nil || geomop.Area(piece) <= 0 {
+			return
+		}
+		if clip == nil {
+			clip = piece
+			return
+		}
+		clip, err = geomop.Construct(clip, piece, geomop.UNION)
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch pieces := polygonsOf(clip); len(pieces) {
+	case 0:
+		return nil, nil
+	case 1:
+		return pieces[0], nil
+	default:
+		return geom.MultiPolygon{Polygons: pieces}, nil
+	}
+}
+
+// CreateFishnet writes a fishnet to basename.shp, basename.shx,
+// basename.dbf and, if opts.Prj is set, basename.prj.
+func CreateFishnet(basename string, opts FishnetOptions) (n int, err error) {
+	var files [3]*os.File
+	for i, ext := range []string{".shp", ".shx", ".dbf"} {
+		if files[i], err = os.Create(basename + ext); err != nil {
+			return
+		}
+		defer func(f *os.File) {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}(files[i])
+	}
+	if opts.Prj != "" {
+		if err = os.WriteFile(basename+".prj", []byte(opts.Prj), 0666); err != nil {
+			return
+		}
+	}
+	return WriteFishnet(files[0], files[1], files[2], opts)
+}
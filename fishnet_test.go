@@ -0,0 +1,125 @@
+package shapefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+func TestWriteFishnet(t *testing.T) {
+	shp, shx, dbf := new(memFile), new(memFile), new(memFile)
+	n, err := WriteFishnet(shp, shx, dbf, FishnetOptions{
+		Extent: geom.Bounds{Min: geom.Point{X: 0, Y: 0}, Max: geom.Point{X: 3, Y: 1.5}},
+		Dx:     1,
+		Dy:     1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 6 {
+		t.Errorf("wrote %d cells", n)
+	}
+	s, err := OpenShapefile(shp.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Header.Xmax != 3 || s.Header.Ymax != 2 {
+		t.Errorf("unexpected header bounds:\n%s", s.Header)
+	}
+	d, err := OpenDBFFile(dbf.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := ReadLayer(s, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := layer.Rows[5]
+	if last[0] != 1 || last[1] != 2 || last[2] != 6 {
+		t.Errorf("unexpected last row: %v", last)
+	}
+	if b := layer.Records[5].Bounds; b.Min.X != 2 || b.Min.Y != 1 {
+		t.Errorf("unexpected last cell: %v", b)
+	}
+}
+
+func TestWriteFishnetMask(t *testing.T) {
+	// two mask polygons side by side, covering x from 0 to 2
+	mask := &Layer{Type: POLYGON}
+	mask.add(&ShapefileRecord{Geometry: square(0, 0, 1)}, nil)
+	mask.add(&ShapefileRecord{Geometry: square(1, 0, 1)}, nil)
+	shp, shx, dbf := new(memFile), new(memFile), new(memFile)
+	n, err := WriteFishnet(shp, shx, dbf, FishnetOptions{
+		Extent: geom.Bounds{Min: geom.Point{X: 0, Y: 0}, Max: geom.Point{X: 4.5, Y: 1}},
+		Dx:     1.5,
+		Dy:     1,
+		Mask:   mask,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("wrote %d cells, want 2", n)
+	}
+	s, err := OpenShapefile(shp.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := OpenDBFFile(dbf.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := ReadLayer(s, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first cell spans both mask polygons, the second is cut at x = 2
+	for i, want := range []float64{1.5, 0.5} {
+		if area, parts := shapeOf(layer.Records[i].Geometry); area != want || parts != 1 {
+			t.Errorf("cell %d: area %g in %d parts, want %g in 1", i, area, parts, want)
+		}
+	}
+	if row := layer.Rows[1]; row[1] != 1 || row[2] != 2 {
+		t.Errorf("unexpected second row: %v", row)
+	}
+}
+
+func TestCreateFishnet(t *testing.T) {
+	dir := t.TempDir()
+	basename := filepath.Join(dir, "fishnet")
+	const prj = `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137,298.257223563]],PRIMEM["Greenwich",0],UNIT["Degree",0.0174532925199433]]`
+	n, err := CreateFishnet(basename, FishnetOptions{
+		Extent: geom.Bounds{Min: geom.Point{X: 0, Y: 0}, Max: geom.Point{X: 2, Y: 2}},
+		Dx:     1,
+		Dy:     1,
+		Prj:    prj,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("wrote %d cells", n)
+	}
+	if data, err := os.ReadFile(basename + ".prj"); err != nil || string(data) != prj {
+		t.Errorf("prj file: %q, %v", data, err)
+	}
+	m, err := OpenMapped(basename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.NumRecords() != 4 || m.DBF == nil || m.DBF.DBFFileHeader.NumRecords != 4 {
+		t.Errorf("unexpected files: %d records", m.NumRecords())
+	}
+
+	if _, err = CreateFishnet(filepath.Join(dir, "plain"), FishnetOptions{
+		Extent: geom.Bounds{Max: geom.Point{X: 1, Y: 1}}, Dx: 1, Dy: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "plain.prj")); err == nil {
+		t.Errorf("prj file written without Prj")
+	}
+}
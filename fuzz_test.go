@@ -0,0 +1,80 @@
+package shapefile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func FuzzOpenShapefile(f *testing.F) {
+	f.Add(pointFile(f, 3))
+	if data, err := os.ReadFile(testfile); err == nil {
+		f.Add(data[:4096])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s, err := OpenShapefile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for {
+			if _, err = s.NextRecord(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func FuzzOpenDBFFile(f *testing.F) {
+	for _, fn := range []string{dbf_test_fn, dbf_test2_fn} {
+		if data, err := os.ReadFile(fn); err == nil {
+			f.Add(data[:min(len(data), 4096)])
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dbf, err := OpenDBFFile(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for {
+			if _, err = dbf.NextRecord(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// polygonRecord returns the content of a POLYGON record with the given
+// counts and parts, followed by one point per part.
+func polygonRecord(nparts, npts int32, parts ...int32) []byte {
+	buf := appendInt32(nil, int32(POLYGON))
+	buf = append(buf, make([]byte, 32)...) // bounds
+	buf = appendInt32(buf, nparts)
+	buf = appendInt32(buf, npts)
+	for _, p := range parts {
+		buf = appendInt32(buf, p)
+	}
+	return append(buf, make([]byte, 16*len(parts))...)
+}
+
+func TestCorruptCounts(t *testing.T) {
+	var lerr *LengthError
+	var perr *PartError
+	for i, test := range []struct {
+		content []byte
+		target  interface{}
+	}{
+		{polygonRecord(-1, 1, 0), &lerr},
+		{polygonRecord(1, 1<<30, 0), &lerr},
+		{polygonRecord(1<<30, 1), &lerr},
+		{polygonRecord(2, 2, 0, 3), &perr},
+		{polygonRecord(2, 2, 1, 0), &perr},
+		{polygonRecord(1, 1, -1), &perr},
+	} {
+		rec := new(ShapefileRecord)
+		err := rec.recordContent(test.content, DefaultOrientation)
+		if !errors.As(err, test.target) {
+			t.Errorf("test %d: unexpected error %v", i, err)
+		}
+	}
+}
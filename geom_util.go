@@ -0,0 +1,378 @@
+package shapefile
+
+import (
+	"math"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// eachPoint calls fn with the XY coordinates of every vertex in g.
+func eachPoint(g geom.T, fn func(geom.Point)) {
+	switch t := g.(type) {
+	case geom.Point:
+		fn(t)
+	case geom.PointZ:
+		fn(geom.Point{X: t.X, Y: t.Y})
+	case geom.PointM:
+		fn(geom.Point{X: t.X, Y: t.Y})
+	case *geom.PointM:
+		fn(geom.Point{X: t.X, Y: t.Y})
+	case geom.PointZM:
+		fn(geom.Point{X: t.X, Y: t.Y})
+	default:
+		for _, part := range geomParts(g) {
+			for _, p := range part {
+				fn(p)
+			}
+		}
+	}
+}
+
+// geomParts returns the rings or line strings of g projected onto the
+// XY plane. Point geometries are returned as a single part.
+func geomParts(g geom.T) [][]geom.Point {
+	switch t := g.(type) {
+	case geom.MultiPoint:
+		return [][]geom.Point{t.Points}
+	case geom.MultiPointZ:
+		pts := make([]geom.Point, len(t.Points))
+		for i, p := range t.Points {
+			pts[i] = geom.Point{X: p.X, Y: p.Y}
+		}
+		return [][]geom.Point{pts}
+	case geom.MultiPointM:
+		pts := make([]geom.Point, len(t.Points))
+		for i, p := range t.Points {
+			pts[i] = geom.Point{X: p.X, Y: p.Y}
+		}
+		return [][]geom.Point{pts}
+	case geom.MultiPointZM:
+		pts := make([]geom.Point, len(t.Points))
+		for i, p := range t.Points {
+			pts[i] = geom.Point{X: p.X, Y: p.Y}
+		}
+		return [][]geom.Point{pts}
+	case geom.LineString:
+		return [][]geom.Point{t.Points}
+	case geom.MultiLineString:
+		parts := make([][]geom.Point, len(t.LineStrings))
+		for i, ls := range t.LineStrings {
+			parts[i] = ls.Points
+		}
+		return parts
+	case geom.MultiLineStringZ:
+		parts := make([][]geom.Point, len(t.LineStrings))
+		for i, ls := range t.LineStrings {
+			parts[i] = make([]geom.Point, len(ls.Points))
+			for j, p := range ls.Points {
+				parts[i][j] = geom.Point{X: p.X, Y: p.Y}
+			}
+		}
+		return parts
+	case geom.MultiLineStringM:
+		parts := make([][]geom.Point, len(t.LineStrings))
+		for i, ls := range t.LineStrings {
+			parts[i] = make([]geom.Point, len(ls.Points))
+			for j, p := range ls.Points {
+				parts[i][j] = geom.Point{X: p.X, Y: p.Y}
+			}
+		}
+		return parts
+	case geom.MultiLineStringZM:
+		parts := make([][]geom.Point, len(t.LineStrings))
+		for i, ls := range t.LineStrings {
+			parts[i] = make([]geom.Point, len(ls.Points))
+			for j, p := range ls.Points {
+				parts[i][j] = geom.Point{X: p.X, Y: p.Y}
+			}
+		}
+		return parts
+	case geom.Polygon:
+		return t.Rings
+	case geom.MultiPolygon:
+		var parts [][]geom.Point
+		for _, pg := range t.Polygons {
+			parts = append(parts, pg.Rings...)
+		}
+		return parts
+	case geom.PolygonZ:
+		parts := make([][]geom.Point, len(t.Rings))
+		for i, r := range t.Rings {
+			parts[i] = make([]geom.Point, len(r))
+			for j, p := range r {
+				parts[i][j] = geom.Point{X: p.X, Y: p.Y}
+			}
+		}
+		return parts
+	case geom.PolygonM:
+		parts := make([][]geom.Point, len(t.Rings))
+		for i, r := range t.Rings {
+			parts[i] = make([]geom.Point, len(r))
+			for j, p := range r {
+				parts[i][j] = geom.Point{X: p.X, Y: p.Y}
+			}
+		}
+		return parts
+	case geom.PolygonZM:
+		parts := make([][]geom.Point, len(t.Rings))
+		for i, r := range t.Rings {
+			parts[i] = make([]geom.Point, len(r))
+			for j, p := range r {
+				parts[i][j] = geom.Point{X: p.X, Y: p.Y}
+			}
+		}
+		return parts
+	}
+	return nil
+}
+
+// isPolygonal reports whether g is one of the polygon geometry types.
+func isPolygonal(g geom.T) bool {
+	switch g.(type) {
+	case geom.Polygon, geom.MultiPolygon, geom.PolygonZ, geom.PolygonM,
+		geom.PolygonZM:
+		return true
+	}
+	return false
+}
+
+// isPuntal reports whether g is one of the point geometry types.
+func isPuntal(g geom.T) bool {
+	switch g.(type) {
+	case geom.Point, geom.PointZ, geom.PointM, *geom.PointM, geom.PointZM,
+		geom.MultiPoint, geom.MultiPointZ, geom.MultiPointM,
+		geom.MultiPointZM:
+		return true
+	}
+	return false
+}
+
+// flatPolygon returns the XY projection of a polygonal geometry in a
+// form geomop can operate on.
+func flatPolygon(g geom.T) geom.T {
+	switch t := g.(type) {
+	case geom.Polygon, geom.MultiPolygon:
+		return t
+	}
+	return geom.Polygon{Rings: geomParts(g)}
+}
+
+// geomBounds returns the XY bounding box of g, or nil if g has no
+// vertices.
+func geomBounds(g geom.T) *geom.Bounds {
+	var b *geom.Bounds
+	eachPoint(g, func(p geom.Point) {
+		if b == nil {
+			b = &geom.Bounds{Min: p, Max: p}
+			return
+		}
+		b.Min.X = math.Min(b.Min.X, p.X)
+		b.Min.Y = math.Min(b.Min.Y, p.Y)
+		b.Max.X = math.Max(b.Max.X, p.X)
+		b.Max.Y = math.Max(b.Max.Y, p.Y)
+	})
+	return b
+}
+
+// boundsOverlap reports whether two bounding boxes share any point.
+func boundsOverlap(a, b *geom.Bounds) bool {
+	return a.Min.X <= b.Max.X && b.Min.X <= a.Max.X &&
+		a.Min.Y <= b.Max.Y && b.Min.Y <= a.Max.Y
+}
+
+// pointInRings reports whether p lies inside the area enclosed by
+// rings, using the even-odd rule so that holes are excluded.
+func pointInRings(p geom.Point, rings [][]geom.Point) bool {
+	in := false
+	for _, r := range rings {
+		for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+			a, b := r[i], r[j]
+			if (a.Y > p.Y) != (b.Y > p.Y) &&
+				p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+				in = !in
+			}
+		}
+	}
+	return in
+}
+
+// segments returns the edges of g. Isolated points are returned as
+// zero-length segments so that they take part in distance and crossing
+// tests.
+func segments(g geom.T) [][2]geom.Point {
+	var segs [][2]geom.Point
+	if isPuntal(g) {
+		eachPoint(g, func(p geom.Point) {
+			segs = append(segs, [2]geom.Point{p, p})
+		})
+		return segs
+	}
+	for _, part := range geomParts(g) {
+		for i := 1; i < len(part); i++ {
+			segs = append(segs, [2]geom.Point{part[i-1], part[i]})
+		}
+	}
+	return segs
+}
+
+func cross(o, a, b geom.Point) float64 {
+	return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+}
+
+func onSegment(p, a, b geom.Point) bool {
+	return math.Min(a.X, b.X) <= p.X && p.X <= math.Max(a.X, b.X) &&
+		math.Min(a.Y, b.Y) <= p.Y && p.Y <= math.Max(a.Y, b.Y)
+}
+
+// segmentsCross reports whether segment ab touches segment cd.
+func segmentsCross(a, b, c, d geom.Point) bool {
+	d1 := cross(c, d, a)
+	d2 := cross(c, d, b)
+	d3 := cross(a, b, c)
+	d4 := cross(a, b, d)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) &&
+		((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && onSegment(a, c, d)) ||
+		(d2 == 0 && onSegment(b, c, d)) ||
+		(d3 == 0 && onSegment(c, a, b)) ||
+		(d4 == 0 && onSegment(d, a, b))
+}
+
+// pointSegmentDistance returns the distance from p to segment ab.
+func pointSegmentDistance(p, a, b geom.Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	l2 := dx*dx + dy*dy
+	if l2 == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / l2
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// intersects reports whether a and b share any point. The common area
+// of two polygons is found with geomop; other geometries are compared
+// by their vertices and edges.
+func intersects(a, b geom.T) (bool, error) {
+	if !isPolygonal(a) || !isPolygonal(b) {
+		return touches(a, b), nil
+	}
+	overlap, err := overlapArea(a, b)
+	if err != nil || overlap > 0 {
+		return overlap > 0, err
+	}
+	// polygons that only share boundary points
+	return touches(a, b), nil
+}
+
+// touches reports whether a and b share any point, testing the vertices
+// of each against the polygons of the other and the edges of both
+// against each other.
+func touches(a, b geom.T) bool {
+	ba, bb := geomBounds(a), geomBounds(b)
+	if ba == nil || bb == nil || !boundsOverlap(ba, bb) {
+		return false
+	}
+	if isPolygonal(b) {
+		rings := geomParts(b)
+		found := false
+		eachPoint(a, func(p geom.Point) {
+			found = found || pointInRings(p, rings)
+		})
+		if found {
+			return true
+		}
+	}
+	if isPolygonal(a) {
+		rings := geomParts(a)
+		found := false
+		eachPoint(b, func(p geom.Point) {
+			found = found || pointInRings(p, rings)
+		})
+		if found {
+			return true
+		}
+	}
+	sb := segments(b)
+	for _, s := range segments(a) {
+		for _, t := range sb {
+			if segmentsCross(s[0], s[1], t[0], t[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// distance returns the shortest distance between a and b, which is
+// zero if they intersect.
+func distance(a, b geom.T) float64 {
+	if touches(a, b) {
+		return 0
+	}
+	d := math.Inf(1)
+	sa, sb := segments(a), segments(b)
+	for _, s := range sa {
+		for _, t := range sb {
+			d = math.Min(d, pointSegmentDistance(s[0], t[0], t[1]))
+			d = math.Min(d, pointSegmentDistance(s[1], t[0], t[1]))
+			d = math.Min(d, pointSegmentDistance(t[0], s[0], s[1]))
+			d = math.Min(d, pointSegmentDistance(t[1], s[0], s[1]))
+		}
+	}
+	return d
+}
+
+// signedArea returns the area enclosed by ring, which is positive if
+// the ring runs counter-clockwise.
+func signedArea(ring []geom.Point) float64 {
+	a := 0.
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a += ring[j].X*ring[i].Y - ring[i].X*ring[j].Y
+	}
+	return a / 2
+}
+
+// ringIsHole reports whether ring i of a polygon lies inside an odd
+// number of the other rings.
+func ringIsHole(rings [][]geom.Point, i int) bool {
+	if len(rings[i]) == 0 {
+		return false
+	}
+	p := rings[i][0]
+	n := 0
+	for j, r := range rings {
+		if j != i && pointInRings(p, [][]geom.Point{r}) {
+			n++
+		}
+	}
+	return n%2 == 1
+}
+
+// esriReverse reports for each ring whether it must be reversed to
+// follow the shapefile convention of clockwise outer rings and
+// counter-clockwise holes.
+func esriReverse(rings [][]geom.Point) []bool {
+	reverse := make([]bool, len(rings))
+	for i, r := range rings {
+		ccw := signedArea(r) > 0
+		reverse[i] = ccw != ringIsHole(rings, i)
+	}
+	return reverse
+}
+
+// polygonsOf returns the polygons making up g, which should be the
+// result of a geomop operation.
+func polygonsOf(g geom.T) []geom.Polygon {
+	switch t := g.(type) {
+	case geom.Polygon:
+		if len(t.Rings) > 0 {
+			return []geom.Polygon{t}
+		}
+	case geom.MultiPolygon:
+		return t.Polygons
+	}
+	return nil
+}
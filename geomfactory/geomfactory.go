@@ -0,0 +1,140 @@
+// Package geomfactory reads and writes shapefile records as
+// github.com/twpayne/go-geom geometries:
+//
+//	r := shapefile.NewReader(shp, geomfactory.Factory{})
+//	g, err := r.Next()
+package geomfactory
+
+import (
+	"fmt"
+
+	"github.com/ctessum/shapefile"
+	"github.com/twpayne/go-geom"
+)
+
+// Factory is a shapefile.Factory for go-geom geometries. Null shapes are
+// nil. Points and multipoints become *geom.Point and *geom.MultiPoint,
+// polylines *geom.MultiLineString, and polygons *geom.Polygon, or
+// *geom.MultiPolygon if they have several exterior rings. The layout
+// follows the Z and M values of the record.
+//
+// When writing, *geom.LineString is accepted as a polyline, and the
+// shape type is chosen from the layout: XYZ and XYZM give Z types and
+// XYM gives M types.
+type Factory struct{}
+
+func (Factory) Geometry(s *shapefile.Shape) (geom.T, error) {
+	layout := geom.XY
+	switch {
+	case s.Z != nil && s.M != nil:
+		layout = geom.XYZM
+	case s.Z != nil:
+		layout = geom.XYZ
+	case s.M != nil:
+		layout = geom.XYM
+	}
+	flat := make([]float64, 0, layout.Stride()*len(s.Points))
+	add := func(start, end int) []float64 {
+		for i := start; i < end; i++ {
+			flat = append(flat, s.Points[i].X, s.Points[i].Y)
+			if s.Z != nil {
+				flat = append(flat, s.Z[i])
+			}
+			if s.M != nil {
+				flat = append(flat, s.M[i])
+			}
+		}
+		return flat
+	}
+	switch s.Type {
+	case shapefile.NULL_SHAPE:
+		return nil, nil
+	case shapefile.POINT, shapefile.POINT_Z, shapefile.POINT_M:
+		return geom.NewPointFlat(layout, add(0, 1)), nil
+	case shapefile.MULTI_POINT, shapefile.MULTI_POINT_Z, shapefile.MULTI_POINT_M:
+		return geom.NewMultiPointFlat(layout, add(0, len(s.Points))), nil
+	case shapefile.POLY_LINE, shapefile.POLY_LINE_Z, shapefile.POLY_LINE_M:
+		ends := make([]int, len(s.Parts))
+		for i := range s.Parts {
+			ends[i] = len(add(s.Part(i)))
+		}
+		return geom.NewMultiLineStringFlat(layout, flat, ends), nil
+	case shapefile.POLYGON, shapefile.POLYGON_Z, shapefile.POLYGON_M:
+		polygons := s.Polygons()
+		endss := make([][]int, len(polygons))
+		for i, rings := range polygons {
+			for _, r := range rings {
+				endss[i] = append(endss[i], len(add(s.Part(r))))
+			}
+		}
+		if len(polygons) == 1 {
+			return geom.NewPolygonFlat(layout, flat, endss[0]), nil
+		}
+		return geom.NewMultiPolygonFlat(layout, flat, endss), nil
+	}
+	return nil, fmt.Errorf("unsupported shape type: %s", s.Type)
+}
+
+func (Factory) Shape(g geom.T) (*shapefile.Shape, error) {
+	var t shapefile.ShapeType
+	var ends []int
+	switch g := g.(type) {
+	case nil:
+		return &shapefile.Shape{Type: shapefile.NULL_SHAPE}, nil
+	case *geom.Point:
+		t = shapefile.POINT
+	case *geom.MultiPoint:
+		t = shapefile.MULTI_POINT
+	case *geom.LineString:
+		t, ends = shapefile.POLY_LINE, []int{len(g.FlatCoords())}
+	case *geom.MultiLineString:
+		t, ends = shapefile.POLY_LINE, g.Ends()
+	case *geom.Polygon:
+		t, ends = shapefile.POLYGON, g.Ends()
+	case *geom.MultiPolygon:
+		t = shapefile.POLYGON
+		for _, e := range g.Endss() {
+			ends = append(ends, e...)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type: %T", g)
+	}
+
+	layout, flat := g.Layout(), g.FlatCoords()
+	stride := layout.Stride()
+	s := &shapefile.Shape{Points: make([]shapefile.Point, len(flat)/stride)}
+	zi, mi := layout.ZIndex(), layout.MIndex()
+	if zi >= 0 {
+		s.Z = make([]float64, len(s.Points))
+	}
+	if mi >= 0 {
+		s.M = make([]float64, len(s.Points))
+	}
+	for i := range s.Points {
+		c := flat[i*stride : (i+1)*stride]
+		s.Points[i] = shapefile.Point{X: c[0], Y: c[1]}
+		if zi >= 0 {
+			s.Z[i] = c[zi]
+		}
+		if mi >= 0 {
+			s.M[i] = c[mi]
+		}
+	}
+	start := 0
+	for _, end := range ends {
+		if end > start {
+			s.Parts = append(s.Parts, int32(start/stride))
+		}
+		start = end
+	}
+
+	// the shape type numbers of Z and M types are offset by 10 and 20
+	switch {
+	case zi >= 0:
+		t += 10
+	case mi >= 0:
+		t += 20
+	}
+	s.Type = t
+	return s, nil
+}
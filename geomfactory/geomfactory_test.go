@@ -0,0 +1,53 @@
+package geomfactory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ctessum/shapefile"
+	"github.com/twpayne/go-geom"
+)
+
+func TestRoundTrip(t *testing.T) {
+	square := func(x, y, size float64) []shapefile.Point {
+		return []shapefile.Point{{X: x, Y: y}, {X: x, Y: y + size},
+			{X: x + size, Y: y + size}, {X: x + size, Y: y}, {X: x, Y: y}}
+	}
+	pts := append(append(square(0, 0, 1), square(5, 5, 1)...), square(5.2, 5.2, 0.5)...)
+	m := make([]float64, len(pts))
+	for i := range m {
+		m[i] = float64(i)
+	}
+	tests := []struct {
+		s    *shapefile.Shape
+		want interface{}
+	}{
+		{&shapefile.Shape{Type: shapefile.NULL_SHAPE}, nil},
+		{&shapefile.Shape{Type: shapefile.POINT_M, Points: pts[:1], M: m[:1]}, &geom.Point{}},
+		{&shapefile.Shape{Type: shapefile.POLY_LINE, Parts: []int32{0, 5}, Points: pts[:10]},
+			&geom.MultiLineString{}},
+		{&shapefile.Shape{Type: shapefile.POLYGON_M, Parts: []int32{0}, Points: pts[:5], M: m[:5]},
+			&geom.Polygon{}},
+		{&shapefile.Shape{Type: shapefile.POLYGON_M, Parts: []int32{0, 5, 10}, Points: pts, M: m},
+			&geom.MultiPolygon{}},
+	}
+	var f Factory
+	for _, test := range tests {
+		g, err := f.Geometry(test.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.TypeOf(g) != reflect.TypeOf(test.want) {
+			t.Errorf("%s: got %T, want %T", test.s.Type, g, test.want)
+			continue
+		}
+		s, err := f.Shape(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Type != test.s.Type || !reflect.DeepEqual(s.Parts, test.s.Parts) ||
+			!reflect.DeepEqual(s.Points, test.s.Points) || !reflect.DeepEqual(s.M, test.s.M) {
+			t.Errorf("%s: got %+v, want %+v", test.s.Type, s, test.s)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/ctessum/shapefile
+
+go 1.23
+
+require (
+	github.com/paulmach/orb v0.11.1
+	github.com/twpayne/go-geom v1.5.7
+)
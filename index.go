@@ -0,0 +1,149 @@
+package shapefile
+
+import (
+	"math"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// gridIndex is a uniform grid of bounding boxes used to find candidate
+// features before running exact geometry tests.
+type gridIndex struct {
+	bounds []*geom.Bounds
+	extent geom.Bounds
+	nx, ny int
+	dx, dy float64
+	cells  [][]int
+	seen   []int // query stamp per item, to report each item once
+	stamp  int
+}
+
+// newGridIndex builds an index over bounds. Nil entries are skipped.
+func newGridIndex(bounds []*geom.Bounds) *gridIndex {
+	idx := &gridIndex{bounds: bounds, seen: make([]int, len(bounds))}
+	n := 0
+	for _, b := range bounds {
+		if b == nil {
+			continue
+		}
+		if n == 0 {
+			idx.extent = *b
+		} else {
+			idx.extent.Min.X = math.Min(idx.extent.Min.X, b.Min.X)
+			idx.extent.Min.Y = math.Min(idx.extent.Min.Y, b.Min.Y)
+			idx.extent.Max.X = math.Max(idx.extent.Max.X, b.Max.X)
+			idx.extent.Max.Y = math.Max(idx.extent.Max.Y, b.Max.Y)
+		}
+		n++
+	}
+	if n == 0 {
+		return idx
+	}
+	// aim for roughly one item per cell
+	side := int(math.Ceil(math.Sqrt(float64(n))))
+	idx.nx, idx.ny = side, side
+	idx.dx = (idx.extent.Max.X - idx.extent.Min.X) / float64(idx.nx)
+	idx.dy = (idx.extent.Max.Y - idx.extent.Min.Y) / float64(idx.ny)
+	if idx.dx == 0 {
+		idx.nx, idx.dx = 1, 1
+	}
+	if idx.dy == 0 {
+		idx.ny, idx.dy = 1, 1
+	}
+	idx.cells = make([][]int, idx.nx*idx.ny)
+	for i, b := range bounds {
+		if b == nil {
+			continue
+		}
+		x0, y0, x1, y1 := idx.cellRange(b)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				c := y*idx.nx + x
+				idx.cells[c] = append(idx.cells[c], i)
+			}
+		}
+	}
+	return idx
+}
+
+func (idx *gridIndex) clampX(v float64) int {
+	i := int(math.Floor((v - idx.extent.Min.X) / idx.dx))
+	return max(0, min(idx.nx-1, i))
+}
+
+func (idx *gridIndex) clampY(v float64) int {
+	i := int(math.Floor((v - idx.extent.Min.Y) / idx.dy))
+	return max(0, min(idx.ny-1, i))
+}
+
+func (idx *gridIndex) cellRange(b *geom.Bounds) (x0, y0, x1, y1 int) {
+	return idx.clampX(b.Min.X), idx.clampY(b.Min.Y),
+		idx.clampX(b.Max.X), idx.clampY(b.Max.Y)
+}
+
+// query calls fn once for every item whose bounding box overlaps b.
+func (idx *gridIndex) query(b *geom.Bounds, fn func(i int)) {
+	if idx.cells == nil || b == nil || !boundsOverlap(b, &idx.extent) {
+		return
+	}
+	idx.stamp++
+	x0, y0, x1, y1 := idx.cellRange(b)
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			for _, i := range idx.cells[y*idx.nx+x] {
+				if idx.seen[i] == idx.stamp {
+					continue
+				}
+				idx.seen[i] = idx.stamp
+				if boundsOverlap(b, idx.bounds[i]) {
+					fn(i)
+				}
+			}
+		}
+	}
+}
+
+// nearest returns the item closest to g according to dist, searching
+// no further than maxDist (unlimited if zero). It returns -1 if there
+// is no such item.
+func (idx *gridIndex) nearest(g geom.T, maxDist float64,
+	dist func(i int) float64) (best int, bestDist float64) {
+	best, bestDist = -1, math.Inf(1)
+	b := geomBounds(g)
+	if idx.cells == nil || b == nil {
+		return
+	}
+	limit := math.Hypot(idx.extent.Max.X-idx.extent.Min.X,
+		idx.extent.Max.Y-idx.extent.Min.Y) +
+		math.Hypot(b.Max.X-b.Min.X, b.Max.Y-b.Min.Y) +
+		math.Abs(b.Min.X-idx.extent.Min.X) + math.Abs(b.Min.Y-idx.extent.Min.Y)
+	if maxDist > 0 {
+		limit = math.Min(limit, maxDist)
+	}
+	r := math.Min(math.Max(idx.dx, idx.dy), limit)
+	for {
+		search := &geom.Bounds{
+			Min: geom.Point{X: b.Min.X - r, Y: b.Min.Y - r},
+			Max: geom.Point{X: b.Max.X + r, Y: b.Max.Y + r},
+		}
+		idx.query(search, func(i int) {
+			if d := dist(i); d < bestDist {
+				best, bestDist = i, d
+			}
+		})
+		// An item found within the box may still be beaten by one
+		// that lies outside the box but within bestDist.
+		if (best >= 0 && bestDist <= r) || r >= limit {
+			break
+		}
+		if best >= 0 {
+			r = math.Min(bestDist, limit)
+		} else {
+			r = math.Min(2*r, limit)
+		}
+	}
+	if maxDist > 0 && bestDist > maxDist {
+		return -1, math.Inf(1)
+	}
+	return
+}
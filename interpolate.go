@@ -0,0 +1,155 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ctessum/geomop"
+)
+
+// InterpolatedField names a numeric source field and how its values
+// are apportioned to the target polygons.
+type InterpolatedField struct {
+	Field string
+	// Intensive fields (densities, rates) are averaged over the target
+	// weighted by overlap area. Extensive fields (counts, emissions)
+	// are split in proportion to the fraction of each source polygon
+	// that falls within the target.
+	Intensive bool
+}
+
+// Interpolation is the result of AreaWeightedInterpolation.
+type Interpolation struct {
+	Fields []InterpolatedField
+	// Values[i][j] is the value of field j allocated to target record i.
+	// Intensive values are NaN for targets no source overlaps.
+	Values [][]float64
+	// Coverage[i] is the fraction of target record i covered by source
+	// polygons.
+	Coverage []float64
+	// Remainder[j] is the amount of extensive field j that lies outside
+	// every target polygon. It is zero for intensive fields.
+	Remainder []float64
+	// UnallocatedArea is the total source area outside every target.
+	UnallocatedArea float64
+}
+
+// AreaWeightedInterpolation reallocates the given fields of the source
+// polygons onto the target polygons by the area of their overlap. Both
+// layers must contain polygons, and the target polygons should not
+// overlap each other, or the overlapping area is counted twice.
+func AreaWeightedInterpolation(src, dst *Layer,
+	fields []InterpolatedField) (ip *Interpolation, err error) {
+	cols := make([]int, len(fields))
+	for j, f := range fields {
+		if cols[j] = src.FieldIndex(f.Field); cols[j] < 0 {
+			return nil, fmt.Errorf("source layer has no field %s", f.Field)
+		}
+	}
+	ip = &Interpolation{
+		Fields:    fields,
+		Values:    make([][]float64, len(dst.Records)),
+		Coverage:  make([]float64, len(dst.Records)),
+		Remainder: make([]float64, len(fields)),
+	}
+	weights := make([]float64, len(dst.Records)) // overlap area per target
+	for i := range ip.Values {
+		ip.Values[i] = make([]float64, len(fields))
+	}
+
+	idx := dst.index()
+	for i, rec := range src.Records {
+		if rec.Geometry == nil {
+			continue
+		}
+		if !isPolygonal(rec.Geometry) {
+			return nil, fmt.Errorf("source record %d is not a polygon", i+1)
+		}
+		area := geomop.Area(flatPolygon(rec.Geometry))
+		if area == 0 {
+			continue
+		}
+		values := make([]float64, len(fields))
+		for j, col := range cols {
+			if src.Rows[i] != nil {
+				values[j], _ = toFloat(src.Rows[i][col])
+			}
+		}
+		allocated := 0.
+		idx.query(geomBounds(rec.Geometry), func(k int) {
+			if err != nil || !isPolygonal(dst.Records[k].Geometry) {
+				return
+			}
+			var overlap float64
+			overlap, err = overlapArea(rec.Geometry, dst.Records[k].Geometry)
+			if err != nil || overlap == 0 {
+				return
+			}
+			allocated += overlap
+			weights[k] += overlap
+			for j, f := range fields {
+				if f.Intensive {
+					ip.Values[k][j] += values[j] * overlap
+				} else {
+					ip.Values[k][j] += values[j] * overlap / area
+				}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("source record %d: %v", i+1, err)
+		}
+		unallocated := math.Max(0, 1-allocated/area)
+		ip.UnallocatedArea += unallocated * area
+		for j, f := range fields {
+			if !f.Intensive {
+				ip.Remainder[j] += values[j] * unallocated
+			}
+		}
+	}
+
+	for k, rec := range dst.Records {
+		if isPolygonal(rec.Geometry) {
+			if area := geomop.Area(flatPolygon(rec.Geometry)); area > 0 {
+				ip.Coverage[k] = math.Min(1, weights[k]/area)
+			}
+		}
+		for j, f := range fields {
+			if !f.Intensive {
+				continue
+			}
+			if weights[k] == 0 {
+				ip.Values[k][j] = math.NaN()
+			} else {
+				ip.Values[k][j] /= weights[k]
+			}
+		}
+	}
+	return ip, nil
+}
+
+// Apply returns a copy of dst with the interpolated values appended as
+// new fields, named after the source fields.
+func (ip *Interpolation) Apply(dst *Layer) *Layer {
+	out := &Layer{Type: dst.Type}
+	out.Fields = append(out.Fields, dst.Fields...)
+	used := make(map[string]bool)
+	for _, fd := range dst.Fields {
+		used[fd.fieldName()] = true
+	}
+	for _, f := range ip.Fields {
+		fd := NewFieldDescriptor(uniqueFieldName(f.Field, used), Number, 19, 6)
+		out.Fields = append(out.Fields, fd)
+	}
+	for i, rec := range dst.Records {
+		row := dst.Rows[i]
+		if row == nil {
+			row = make([]interface{}, len(dst.Fields))
+		}
+		values := make([]interface{}, len(ip.Fields))
+		for j, v := range ip.Values[i] {
+			values[j] = v
+		}
+		out.add(rec, row, values)
+	}
+	return out
+}
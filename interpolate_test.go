@@ -0,0 +1,72 @@
+package shapefile
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAreaWeightedInterpolation(t *testing.T) {
+	src := &Layer{
+		Type: POLYGON,
+		Fields: []FieldDescriptor{
+			NewFieldDescriptor("POP", Number, 10, 0),
+			NewFieldDescriptor("DENS", Number, 10, 2),
+		},
+	}
+	src.add(&ShapefileRecord{Geometry: square(0, 0, 2)}, []interface{}{100, 10.})
+	src.add(&ShapefileRecord{Geometry: square(2, 0, 2)}, []interface{}{40, 30.})
+
+	dst := &Layer{
+		Type:   POLYGON,
+		Fields: []FieldDescriptor{NewFieldDescriptor("ID", Number, 4, 0)},
+	}
+	dst.add(&ShapefileRecord{Geometry: square(1, 0, 2)}, []interface{}{1})   // half of each source
+	dst.add(&ShapefileRecord{Geometry: square(10, 10, 1)}, []interface{}{2}) // no source
+	dst.add(&ShapefileRecord{Geometry: square(3, -1, 2)}, []interface{}{3})  // a quarter of the second
+
+	ip, err := AreaWeightedInterpolation(src, dst, []InterpolatedField{
+		{Field: "POP"},
+		{Field: "DENS", Intensive: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nan := math.NaN()
+	wantValues := [][]float64{{100./2 + 40./2, (10*2 + 30*2) / 4.}, {0, nan}, {40. / 4, 30}}
+	wantCoverage := []float64{1, 0, 0.25}
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) < 1e-9 || math.IsNaN(a) && math.IsNaN(b)
+	}
+	for i := range wantValues {
+		for j, want := range wantValues[i] {
+			if !near(ip.Values[i][j], want) {
+				t.Errorf("target %d field %s: got %g, want %g", i+1, ip.Fields[j].Field, ip.Values[i][j], want)
+			}
+		}
+		if !near(ip.Coverage[i], wantCoverage[i]) {
+			t.Errorf("target %d coverage: got %g, want %g", i+1, ip.Coverage[i], wantCoverage[i])
+		}
+	}
+	// half of the first source and a quarter of the second fall outside
+	if !near(ip.Remainder[0], 100./2+40./4) || ip.Remainder[1] != 0 {
+		t.Errorf("remainder %v", ip.Remainder)
+	}
+	if total := ip.Values[0][0] + ip.Values[2][0] + ip.Remainder[0]; !near(total, 140) {
+		t.Errorf("extensive total %g, want 140", total)
+	}
+	if !near(ip.UnallocatedArea, 2+1) {
+		t.Errorf("unallocated area %g, want 3", ip.UnallocatedArea)
+	}
+
+	out := ip.Apply(dst)
+	if len(out.Fields) != 3 || out.Fields[1].fieldName() != "POP" || out.Fields[2].fieldName() != "DENS" {
+		t.Errorf("fields %v", out.Fields)
+	}
+	if out.Rows[2][0] != 3 || !near(out.Rows[2][1].(float64), 10) {
+		t.Errorf("row %v", out.Rows[2])
+	}
+
+	if _, err = AreaWeightedInterpolation(src, dst, []InterpolatedField{{Field: "NONE"}}); err == nil {
+		t.Errorf("no error for an unknown field")
+	}
+}
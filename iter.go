@@ -0,0 +1,119 @@
+package shapefile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"iter"
+)
+
+// Records returns an iterator over the remaining records of the file.
+// Iteration ends at the end of the file, after the first error, which is
+// yielded with a nil record, or when ctx is cancelled, in which case
+// ctx.Err() is yielded.
+func (s *Shapefile) Records(ctx context.Context) iter.Seq2[*ShapefileRecord, error] {
+	return func(yield func(*ShapefileRecord, error) bool) {
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			rec, err := s.NextRecord()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(rec, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Rows returns an iterator over the remaining rows of the file. Deleted
+// rows are skipped. Errors and cancellation are handled as in
+// Shapefile.Records.
+func (dbf *DBFFile) Rows(ctx context.Context) iter.Seq2[[]interface{}, error] {
+	return func(yield func([]interface{}, error) bool) {
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			row, err := dbf.NextRecord()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+			if row == nil {
+				continue
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Feature is a shapefile record together with its attributes.
+type Feature struct {
+	Record *ShapefileRecord
+	Row    []interface{} // nil if the row is deleted or there is no dbf
+}
+
+// Features returns an iterator that reads shp and dbf in step, pairing
+// each record with the row given by its FeatureID, so that records
+// skipped in lenient mode do not shift the rows of the others. dbf may be
+// nil. Unless records were skipped, it is an error for the files to hold
+// different numbers of records. Errors and cancellation are handled as
+// in Shapefile.Records.
+func Features(ctx context.Context, shp *Shapefile, dbf *DBFFile) iter.Seq2[Feature, error] {
+	return func(yield func(Feature, error) bool) {
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(Feature{}, err)
+				return
+			}
+			var f Feature
+			var err error
+			f.Record, err = shp.NextRecord()
+			if err == io.EOF {
+				if dbf != nil && len(shp.Warnings()) == 0 &&
+					dbf.countRead != dbf.DBFFileHeader.NumRecords {
+					yield(Feature{}, fmt.Errorf("shapefile and dbf differ in length at record %d",
+						dbf.countRead+1))
+				}
+				return
+			} else if err != nil {
+				yield(Feature{}, err)
+				return
+			}
+			if dbf != nil {
+				if f.Row, err = matchingRow(dbf, f.Record); err != nil {
+					yield(Feature{}, err)
+					return
+				}
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// matchingRow reads the row of rec from dbf, skipping the rows of any
+// records that were skipped before it.
+func matchingRow(dbf *DBFFile, rec *ShapefileRecord) (row []interface{}, err error) {
+	i := rec.FeatureID()
+	if err = dbf.skipTo(i); err != nil {
+		return
+	}
+	if row, err = dbf.NextRecord(); err == io.EOF {
+		err = fmt.Errorf("shapefile and dbf differ in length at record %d", i+1)
+	}
+	return
+}
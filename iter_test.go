@@ -0,0 +1,96 @@
+package shapefile
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	shpFile, _ := os.Open(testfile)
+	defer shpFile.Close()
+	dbfFile, _ := os.Open(dbf_test_fn)
+	defer dbfFile.Close()
+	shp, err := OpenShapefile(shpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := OpenDBFFile(dbfFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for f, err := range Features(context.Background(), shp, dbf) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Record.Geometry == nil || len(f.Row) != 4 {
+			t.Errorf("feature %d: %v, %v", n, f.Record, f.Row)
+		}
+		n++
+	}
+	if n != 299 {
+		t.Errorf("read %d features", n)
+	}
+}
+
+func TestRecordsBreak(t *testing.T) {
+	file, _ := os.Open(testfile)
+	defer file.Close()
+	shp, err := OpenShapefile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rec, err := range shp.Records(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.header.RecordNumber == 10 {
+			break
+		}
+	}
+	// iteration resumes after the last record read
+	n := 0
+	for rec, err := range shp.Records(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 && rec.header.RecordNumber != 11 {
+			t.Errorf("resumed at record %d", rec.header.RecordNumber)
+		}
+		n++
+	}
+	if n != 289 {
+		t.Errorf("read %d more records", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, err := range shp.Records(ctx) {
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	}
+}
+
+func TestRows(t *testing.T) {
+	file, _ := os.Open(dbf_test2_fn)
+	defer file.Close()
+	dbf, err := OpenDBFFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for row, err := range dbf.Rows(context.Background()) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row == nil {
+			t.Fatal("nil row")
+		}
+		n++
+	}
+	if n == 0 || n > int(dbf.DBFFileHeader.NumRecords) {
+		t.Errorf("read %d of %d rows", n, dbf.DBFFileHeader.NumRecords)
+	}
+}
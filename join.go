@@ -0,0 +1,308 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ctessum/geomop"
+	"github.com/twpayne/gogeom/geom"
+)
+
+// SpatialPredicate selects the features of the join layer that match a
+// target feature.
+type SpatialPredicate int
+
+const (
+	Intersects SpatialPredicate = iota // the features share any point
+	Within                             // the target lies within the join feature
+	Contains                           // the target contains the join feature
+	Nearest                            // the join feature closest to the target
+)
+
+// JoinMode controls how many output features a target produces.
+type JoinMode int
+
+const (
+	JoinFirst          JoinMode = iota // the first matching feature
+	JoinLargestOverlap                 // the match sharing the most area
+	JoinOneToMany                      // one output feature per match
+)
+
+// Aggregation summarizes a field over several features.
+type Aggregation int
+
+const (
+	AggCount Aggregation = iota // number of features
+	AggSum                      // sum of the field
+	AggMean                     // mean of the field
+	AggMin                      // smallest value of the field
+	AggMax                      // largest value of the field
+	AggFirst                    // value of the field in the first feature
+)
+
+func (a Aggregation) String() string {
+	switch a {
+	case AggCount:
+		return "COUNT"
+	case AggSum:
+		return "SUM"
+	case AggMean:
+		return "MEAN"
+	case AggMin:
+		return "MIN"
+	case AggMax:
+		return "MAX"
+	case AggFirst:
+		return "FIRST"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// FieldAggregation names a field and the aggregation to apply to it.
+// Field is ignored for AggCount.
+type FieldAggregation struct {
+	Field       string
+	Aggregation Aggregation
+}
+
+// JoinOptions configures SpatialJoin.
+type JoinOptions struct {
+	Predicate SpatialPredicate
+	Mode      JoinMode
+	// If Aggregations is set, the attributes of all matches are
+	// summarized instead of copied and Mode is ignored: every target
+	// produces exactly one output feature.
+	Aggregations []FieldAggregation
+	// MaxDistance limits the search radius of Nearest. Zero means no
+	// limit.
+	MaxDistance float64
+}
+
+// SpatialJoin copies the attributes of the features in join onto the
+// features of target that match them by opts.Predicate. Targets without
+// a match are kept with blank join attributes. Within and Contains only
+// match when the containing feature is a polygon; points and lines are
+// considered within a polygon when all of their vertices are.
+func SpatialJoin(target, join *Layer, opts JoinOptions) (out *Layer, err error) {
+	out = &Layer{Type: target.Type}
+	out.Fields = append(out.Fields, target.Fields...)
+	used := make(map[string]bool)
+	for _, fd := range target.Fields {
+		used[fd.fieldName()] = true
+	}
+
+	var aggCols []int // join field of each aggregation
+	if len(opts.Aggregations) > 0 {
+		var fields []FieldDescriptor
+		if fields, aggCols, err = aggregateFields(join, opts.Aggregations, used); err != nil {
+			return nil, err
+		}
+		out.Fields = append(out.Fields, fields...)
+	} else {
+		for _, fd := range join.Fields {
+			out.Fields = append(out.Fields,
+				renameField(fd, uniqueFieldName(fd.fieldName(), used)))
+		}
+	}
+
+	idx := join.index()
+	for i, rec := range target.Records {
+		var matches []int
+		if matches, err = joinMatches(rec.Geometry, join, idx, opts); err != nil {
+			return nil, fmt.Errorf("record %d: %v", i+1, err)
+		}
+		row := target.Rows[i]
+		if row == nil {
+			row = make([]interface{}, len(target.Fields))
+		}
+		switch {
+		case len(opts.Aggregations) > 0:
+			extra := make([]interface{}, len(opts.Aggregations))
+			for j, a := range opts.Aggregations {
+				extra[j] = aggregate(a.Aggregation, join.Rows, matches, aggCols[j])
+			}
+			out.add(rec, row, extra)
+		case len(matches) == 0:
+			out.add(rec, row, make([]interface{}, len(join.Fields)))
+		case opts.Mode == JoinOneToMany:
+			for _, m := range matches {
+				out.add(rec, row, joinRow(join, m))
+			}
+		case opts.Mode == JoinLargestOverlap && len(matches) > 1:
+			best, bestArea := matches[0], -1.
+			for _, m := range matches {
+				var a float64
+				if a, err = overlapArea(rec.Geometry, join.Records[m].Geometry); err != nil {
+					return nil, fmt.Errorf("record %d: %v", i+1, err)
+				}
+				if a > bestArea {
+					best, bestArea = m, a
+				}
+			}
+			out.add(rec, row, joinRow(join, best))
+		default:
+			out.add(rec, row, joinRow(join, matches[0]))
+		}
+	}
+	return out, nil
+}
+
+func joinRow(join *Layer, i int) []interface{} {
+	if join.Rows[i] == nil {
+		return make([]interface{}, len(join.Fields))
+	}
+	return join.Rows[i]
+}
+
+// joinMatches returns the indices of the features of join that match g,
+// in file order.
+func joinMatches(g geom.T, join *Layer, idx *gridIndex,
+	opts JoinOptions) (matches []int, err error) {
+	if g == nil {
+		return nil, nil
+	}
+	if opts.Predicate == Nearest {
+		best, _ := idx.nearest(g, opts.MaxDistance, func(i int) float64 {
+			if join.Records[i].Geometry == nil {
+				return math.Inf(1)
+			}
+			return distance(g, join.Records[i].Geometry)
+		})
+		if best >= 0 {
+			matches = append(matches, best)
+		}
+		return
+	}
+	idx.query(geomBounds(g), func(i int) {
+		if err != nil {
+			return
+		}
+		jg := join.Records[i].Geometry
+		var ok bool
+		switch opts.Predicate {
+		case Intersects:
+			ok, err = intersects(g, jg)
+		case Within:
+			ok, err = within(g, jg)
+		case Contains:
+			ok, err = within(jg, g)
+		default:
+			err = fmt.Errorf("unknown spatial predicate: %d", opts.Predicate)
+		}
+		if ok {
+			matches = append(matches, i)
+		}
+	})
+	// the index reports candidates cell by cell
+	sort.Ints(matches)
+	return
+}
+
+// within reports whether a lies within the polygon b. A polygon is
+// within b if geomop leaves none of its area outside b; points and lines
+// are within b if all of their vertices are.
+func within(a, b geom.T) (bool, error) {
+	if a == nil || !isPolygonal(b) {
+		return false, nil
+	}
+	if !isPolygonal(a) {
+		rings := geomParts(b)
+		in := true
+		eachPoint(a, func(p geom.Point) {
+			in = in && pointInRings(p, rings)
+		})
+		return in, nil
+	}
+	ab, bb := geomBounds(a), geomBounds(b)
+	if ab == nil || bb == nil || !boundsOverlap(ab, bb) || geomop.Area(flatPolygon(a)) == 0 {
+		return false, nil
+	}
+	rest, err := geomop.Construct(flatPolygon(a), flatPolygon(b), geomop.DIFFERENCE)
+	if err != nil {
+		return false, err
+	}
+	return rest == nil || geomop.Area(rest) == 0, nil
+}
+
+// overlapArea returns the area shared by two polygons, which is zero if
+// either of them is not a polygon.
+func overlapArea(a, b geom.T) (float64, error) {
+	if !isPolygonal(a) || !isPolygonal(b) {
+		return 0, nil
+	}
+	ab, bb := geomBounds(a), geomBounds(b)
+	if ab == nil || bb == nil || !boundsOverlap(ab, bb) {
+		return 0, nil
+	}
+	g, err := geomop.Construct(flatPolygon(a), flatPolygon(b), geomop.INTERSECTION)
+	if err != nil || g == nil {
+		return 0, err
+	}
+	return geomop.Area(g), nil
+}
+
+// aggregateFields returns the output fields of the given aggregations
+// over layer, and the layer field each of them reads.
+func aggregateFields(layer *Layer, aggs []FieldAggregation,
+	used map[string]bool) (fields []FieldDescriptor, cols []int, err error) {
+	for _, a := range aggs {
+		col := -1
+		fd := NewFieldDescriptor("", Number, 19, 6)
+		name := a.Aggregation.String()
+		if a.Aggregation == AggCount {
+			fd.DecimalCount = 0
+			fd.FieldLength = 10
+		} else if col = layer.FieldIndex(a.Field); col < 0 {
+			return nil, nil, fmt.Errorf("layer has no field %s", a.Field)
+		} else {
+			name += "_" + a.Field
+			if a.Aggregation == AggFirst {
+				fd = layer.Fields[col]
+			}
+		}
+		fields = append(fields, renameField(fd, uniqueFieldName(name, used)))
+		cols = append(cols, col)
+	}
+	return
+}
+
+// aggregate summarizes column col of the given rows.
+func aggregate(a Aggregation, rows [][]interface{}, matches []int, col int) interface{} {
+	switch a {
+	case AggCount:
+		return len(matches)
+	case AggFirst:
+		for _, m := range matches {
+			if rows[m] != nil {
+				return rows[m][col]
+			}
+		}
+		return nil
+	}
+	sum, lo, hi, n := 0., math.Inf(1), math.Inf(-1), 0
+	for _, m := range matches {
+		if rows[m] == nil {
+			continue
+		}
+		if v, ok := toFloat(rows[m][col]); ok {
+			sum += v
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+			n++
+		}
+	}
+	switch {
+	case a == AggSum:
+		return sum
+	case n == 0:
+		return nil
+	case a == AggMean:
+		return sum / float64(n)
+	case a == AggMin:
+		return lo
+	case a == AggMax:
+		return hi
+	}
+	return nil
+}
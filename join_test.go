@@ -0,0 +1,172 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// joinZones returns a layer of three zones: A and B side by side, and C
+// inside A.
+func joinZones() *Layer {
+	zones := &Layer{
+		Type:   POLYGON,
+		Fields: []FieldDescriptor{NewFieldDescriptor("ZONE", Character, 4, 0)},
+	}
+	zones.add(&ShapefileRecord{Geometry: square(0, 0, 10)}, []interface{}{"A"})
+	zones.add(&ShapefileRecord{Geometry: square(10, 0, 10)}, []interface{}{"B"})
+	zones.add(&ShapefileRecord{Geometry: square(2, 2, 2)}, []interface{}{"C"})
+	return zones
+}
+
+func TestSpatialJoin(t *testing.T) {
+	targets := &Layer{
+		Type:   POLYGON,
+		Fields: []FieldDescriptor{NewFieldDescriptor("T", Number, 4, 0)},
+	}
+	targets.add(&ShapefileRecord{Geometry: square(1, 1, 4)}, []interface{}{1})  // in A, around C
+	targets.add(&ShapefileRecord{Geometry: square(9, 1, 4)}, []interface{}{2})  // mostly in B
+	targets.add(&ShapefileRecord{Geometry: square(20, 0, 1)}, []interface{}{3}) // touches B
+	targets.add(&ShapefileRecord{Geometry: square(30, 0, 1)}, []interface{}{4}) // 10 from B
+
+	tests := []struct {
+		name string
+		opts JoinOptions
+		want []string // target and zone of each output feature
+	}{
+		{"intersects", JoinOptions{Predicate: Intersects},
+			[]string{"1 A", "2 A", "3 B", "4 <nil>"}},
+		{"within", JoinOptions{Predicate: Within},
+			[]string{"1 A", "2 <nil>", "3 <nil>", "4 <nil>"}},
+		{"contains", JoinOptions{Predicate: Contains},
+			[]string{"1 C", "2 <nil>", "3 <nil>", "4 <nil>"}},
+		{"nearest", JoinOptions{Predicate: Nearest},
+			[]string{"3 B", "4 B"}},
+		{"nearest within 5", JoinOptions{Predicate: Nearest, MaxDistance: 5},
+			[]string{"3 B", "4 <nil>"}},
+		{"largest overlap", JoinOptions{Predicate: Intersects, Mode: JoinLargestOverlap},
+			[]string{"1 A", "2 B", "3 B", "4 <nil>"}},
+		{"one to many", JoinOptions{Predicate: Intersects, Mode: JoinOneToMany},
+			[]string{"1 A", "1 C", "2 A", "2 B", "3 B", "4 <nil>"}},
+	}
+	for _, test := range tests {
+		out, err := SpatialJoin(targets, joinZones(), test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(out.Fields) != 2 || out.Fields[1].fieldName() != "ZONE" {
+			t.Errorf("%s: fields %v", test.name, out.Fields)
+		}
+		var got []string
+		for i, row := range out.Rows {
+			if out.Records[i].Geometry == nil {
+				t.Errorf("%s: feature %d has no geometry", test.name, i)
+			}
+			got = append(got, fmt.Sprint(row[0], " ", row[1]))
+		}
+		if test.opts.Predicate == Nearest {
+			// the first two targets overlap two zones each
+			got = got[2:]
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSpatialJoinAggregations(t *testing.T) {
+	zones := joinZones()
+	zones.add(&ShapefileRecord{Geometry: square(40, 0, 1)}, []interface{}{"D"})
+	sites := &Layer{
+		Type:   POINT,
+		Fields: []FieldDescriptor{NewFieldDescriptor("N", Number, 4, 0)},
+	}
+	sites.add(&ShapefileRecord{Geometry: geom.Point{X: 1, Y: 1}}, []interface{}{1})
+	sites.add(&ShapefileRecord{Geometry: geom.Point{X: 3, Y: 3}}, []interface{}{2})
+	sites.add(&ShapefileRecord{Geometry: geom.Point{X: 15, Y: 5}}, []interface{}{4})
+	sites.add(&ShapefileRecord{Geometry: geom.Point{X: 30, Y: 5}}, []interface{}{8})
+
+	tests := []struct {
+		agg   FieldAggregation
+		field string
+		want  []interface{} // for zones A, B, C and D
+	}{
+		{FieldAggregation{Aggregation: AggCount}, "COUNT", []interface{}{2, 1, 1, 0}},
+		{FieldAggregation{Field: "N", Aggregation: AggSum}, "SUM_N", []interface{}{3., 4., 2., 0.}},
+		{FieldAggregation{Field: "N", Aggregation: AggMean}, "MEAN_N", []interface{}{1.5, 4., 2., nil}},
+		{FieldAggregation{Field: "N", Aggregation: AggMin}, "MIN_N", []interface{}{1., 4., 2., nil}},
+		{FieldAggregation{Field: "N", Aggregation: AggMax}, "MAX_N", []interface{}{2., 4., 2., nil}},
+		{FieldAggregation{Field: "N", Aggregation: AggFirst}, "FIRST_N", []interface{}{1, 4, 2, nil}},
+	}
+	var aggs []FieldAggregation
+	for _, test := range tests {
+		aggs = append(aggs, test.agg)
+	}
+	out, err := SpatialJoin(zones, sites, JoinOptions{Predicate: Contains, Aggregations: aggs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Rows) != 4 {
+		t.Fatalf("%d features, want one per zone", len(out.Rows))
+	}
+	for k, test := range tests {
+		if name := out.Fields[1+k].fieldName(); name != test.field {
+			t.Errorf("%s: field %s, want %s", test.agg.Aggregation, name, test.field)
+		}
+		for i, row := range out.Rows {
+			if row[1+k] != test.want[i] {
+				t.Errorf("%s of zone %v: got %v, want %v", test.agg.Aggregation, row[0], row[1+k], test.want[i])
+			}
+		}
+	}
+	writeTestLayer(t, out)
+
+	// points within zones
+	out, err = SpatialJoin(sites, zones, JoinOptions{Predicate: Within})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []interface{}{"A", "A", "B", nil} {
+		if out.Rows[i][1] != want {
+			t.Errorf("site %d: got %v, want %v", i, out.Rows[i][1], want)
+		}
+	}
+	if _, err = SpatialJoin(zones, sites, JoinOptions{Aggregations: []FieldAggregation{
+		{Field: "NONE", Aggregation: AggSum}}}); err == nil {
+		t.Errorf("no error for an unknown field")
+	}
+}
+
+func TestIntersectsDistance(t *testing.T) {
+	line := geom.LineString{Points: []geom.Point{{X: -1, Y: 5}, {X: 1, Y: 5}}}
+	tests := []struct {
+		name       string
+		a, b       geom.T
+		intersects bool
+		distance   float64
+	}{
+		{"point inside", geom.Point{X: 5, Y: 5}, square(0, 0, 10), true, 0},
+		{"point outside", geom.Point{X: 13, Y: 14}, square(0, 0, 10), false, 5},
+		{"line across edge", line, square(0, 0, 10), true, 0},
+		{"overlapping", square(5, 5, 10), square(0, 0, 10), true, 0},
+		{"nested", square(2, 2, 2), square(0, 0, 10), true, 0},
+		{"sharing an edge", square(10, 0, 10), square(0, 0, 10), true, 0},
+		{"sharing a corner", square(10, 10, 1), square(0, 0, 10), true, 0},
+		{"apart", square(13, 0, 1), square(0, 0, 10), false, 3},
+	}
+	for _, test := range tests {
+		got, err := intersects(test.a, test.b)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if got != test.intersects {
+			t.Errorf("%s: intersects %v, want %v", test.name, got, test.intersects)
+		}
+		if d := distance(test.a, test.b); math.Abs(d-test.distance) > 1e-12 {
+			t.Errorf("%s: distance %g, want %g", test.name, d, test.distance)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package shapefile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// Layer holds the records of a shapefile in memory together with the
+// matching rows of its .dbf file. Rows[i] holds the attributes of
+// Records[i]; deleted rows are nil.
+type Layer struct {
+	Type    ShapeType
+	Fields  []FieldDescriptor
+	Records []*ShapefileRecord
+	Rows    [][]interface{}
+}
+
+// ReadLayer reads all records from shp and all rows from dbf. dbf may
+// be nil, in which case the layer has no attributes. Records are paired
+// with rows as by Features.
+func ReadLayer(shp *Shapefile, dbf *DBFFile) (layer *Layer, err error) {
+	layer = &Layer{Type: shp.Header.ShapeType}
+	for {
+		var rec *ShapefileRecord
+		if rec, err = shp.NextRecord(); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		layer.Records = append(layer.Records, rec)
+	}
+	layer.Rows = make([][]interface{}, len(layer.Records))
+	if dbf == nil {
+		return layer, nil
+	}
+	layer.Fields = dbf.Fields()
+	if len(shp.Warnings()) == 0 && int(dbf.DBFFileHeader.NumRecords) != len(layer.Records) {
+		return nil, fmt.Errorf("shapefile has %d records, dbf has: %d",
+			len(layer.Records), dbf.DBFFileHeader.NumRecords)
+	}
+	for i, rec := range layer.Records {
+		if layer.Rows[i], err = matchingRow(dbf, rec); err != nil {
+			return nil, err
+		}
+	}
+	return layer, nil
+}
+
+// FieldIndex returns the position of the named field, or -1 if the
+// layer has no such field.
+func (layer *Layer) FieldIndex(name string) int {
+	for i := range layer.Fields {
+		if layer.Fields[i].fieldName() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Schema returns the columns of the fields of the layer.
+func (layer *Layer) Schema() Schema {
+	return NewSchema(layer.Fields)
+}
+
+// Write writes the layer to a new shapefile. shx and dbf may be nil.
+func (layer *Layer) Write(shp, shx, dbf io.WriteSeeker) (err error) {
+	var sw *ShapefileWriter
+	if sw, err = NewShapefileWriter(shp, shx, layer.Type); err != nil {
+		return
+	}
+	var dw *DBFWriter
+	if dbf != nil {
+		if dw, err = NewDBFWriter(dbf, layer.Fields); err != nil {
+			return
+		}
+	}
+	for i, rec := range layer.Records {
+		if err = sw.Write(rec.Geometry); err != nil {
+			return fmt.Errorf("record %d: %v", i+1, err)
+		}
+		if dw == nil {
+			continue
+		}
+		row := layer.Rows[i]
+		if row == nil {
+			row = make([]interface{}, len(layer.Fields))
+		}
+		if err = dw.Write(row); err != nil {
+			return fmt.Errorf("record %d: %v", i+1, err)
+		}
+	}
+	if err = sw.Close(); err != nil {
+		return
+	}
+	if dw != nil {
+		err = dw.Close()
+	}
+	return
+}
+
+// bounds returns the bounding box of each record.
+func (layer *Layer) bounds() []*geom.Bounds {
+	bb := make([]*geom.Bounds, len(layer.Records))
+	for i, rec := range layer.Records {
+		if rec.Bounds != nil {
+			bb[i] = rec.Bounds
+		} else {
+			bb[i] = geomBounds(rec.Geometry)
+		}
+	}
+	return bb
+}
+
+// add appends a record whose attributes are the concatenation of rows.
+func (layer *Layer) add(rec *ShapefileRecord, rows ...[]interface{}) {
+	var row []interface{}
+	for _, r := range rows {
+		row = append(row, r...)
+	}
+	layer.Records = append(layer.Records, rec)
+	layer.Rows = append(layer.Rows, row)
+}
+
+// index returns a spatial index over the records.
+func (layer *Layer) index() *gridIndex {
+	return newGridIndex(layer.bounds())
+}
+
+// uniqueFieldName returns name shortened to the 10 byte DBF limit and,
+// if needed, suffixed to differ from the names in used, which it adds
+// the result to.
+func uniqueFieldName(name string, used map[string]bool) string {
+	if len(name) > 10 {
+		name = name[:10]
+	}
+	for i := 1; used[name]; i++ {
+		suffix := strconv.Itoa(i)
+		base := name
+		if len(base)+len(suffix) > 10 {
+			base = base[:10-len(suffix)]
+		}
+		name = base + suffix
+	}
+	used[name] = true
+	return name
+}
+
+// renameField returns a copy of fd with a new name.
+func renameField(fd FieldDescriptor, name string) FieldDescriptor {
+	fd.FieldName_ = [11]byte{}
+	copy(fd.FieldName_[:], name)
+	return fd
+}
+
+// toFloat converts a numeric DBF value to float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case int:
+		return float64(val), true
+	case float64:
+		return val, !math.IsNaN(val)
+	}
+	return 0, false
+}
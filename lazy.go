@@ -0,0 +1,124 @@
+package shapefile
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// contentPool holds record content buffers for LazyRecord.
+var contentPool = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// LazyRecord is a record whose geometry is only decoded when it is asked
+// for. The record number, shape type and bounds are read straight from
+// the raw content, which is kept in a pooled buffer until the geometry
+// is decoded or the record is released.
+type LazyRecord struct {
+	Number int32 // record number, counting from one
+	Offset int64 // byte offset of the record header
+
+	buf         *[]byte // pooled content, nil once released
+	rec         *ShapefileRecord
+	err         error
+	index       int // position in the file, counting from zero
+	orientation Orientation
+}
+
+// NextLazyRecord reads the next record in the file without decoding its
+// geometry. If end of file, err=io.EOF. In lenient mode, records whose
+// header or length is broken are skipped; broken content is only found
+// when the geometry is decoded.
+func (s *Shapefile) NextLazyRecord() (*LazyRecord, error) {
+	buf := contentPool.Get().(*[]byte)
+	for {
+		hdr, content, err := s.readRecord(*buf)
+		*buf = content
+		if err == nil {
+			return &LazyRecord{Number: hdr.RecordNumber, Offset: s.last, buf: buf,
+				index: s.n - 1, orientation: s.orientation}, nil
+		}
+		if err = s.recover(err); err != nil {
+			contentPool.Put(buf)
+			return nil, err
+		}
+	}
+}
+
+func (r *LazyRecord) view() RecordView {
+	v := RecordView{Number: r.Number, Offset: r.Offset, index: r.index, orientation: r.orientation}
+	if r.buf != nil {
+		v.Content = *r.buf
+	}
+	return v
+}
+
+// Type returns the shape type of the record. It panics if the record
+// was released without being decoded.
+func (r *LazyRecord) Type() ShapeType {
+	if r.rec != nil {
+		return r.rec.Type
+	}
+	r.mustHaveContent()
+	return r.view().Type()
+}
+
+// Bounds returns the bounding box stored in the record, or the location
+// of a point record. ok is false for null shapes. It panics if the
+// record was released without being decoded.
+func (r *LazyRecord) Bounds() (bounds geom.Bounds, ok bool) {
+	if r.rec != nil {
+		if r.rec.Bounds != nil {
+			return *r.rec.Bounds, true
+		}
+		return
+	}
+	r.mustHaveContent()
+	return r.view().Bounds()
+}
+
+func (r *LazyRecord) mustHaveContent() {
+	if r.buf == nil {
+		panic(fmt.Sprintf("shapefile: record %d used after Release", r.Number))
+	}
+}
+
+// Record decodes the record on the first call, releasing its content
+// buffer, and returns the decoded record on later calls. If decoding
+// fails, the content is kept for Type and Bounds until Release.
+func (r *LazyRecord) Record() (*ShapefileRecord, error) {
+	if r.rec != nil || r.err != nil {
+		return r.rec, r.err
+	}
+	if r.buf == nil {
+		return nil, fmt.Errorf("record %d: released before decoding", r.Number)
+	}
+	r.rec, r.err = r.view().Decode()
+	if r.err != nil {
+		r.rec = nil
+		return nil, r.err
+	}
+	r.Release()
+	return r.rec, nil
+}
+
+// Geometry returns the geometry of the record, decoding it on the first
+// call.
+func (r *LazyRecord) Geometry() (geom.T, error) {
+	rec, err := r.Record()
+	if err != nil {
+		return nil, err
+	}
+	return rec.Geometry, nil
+}
+
+// Release returns the content buffer of the record to the pool. It is
+// only needed for records whose geometry is never decoded. Afterwards
+// only the record number and anything already decoded are available;
+// Type and Bounds panic if the record was not decoded.
+func (r *LazyRecord) Release() {
+	if r.buf != nil {
+		contentPool.Put(r.buf)
+		r.buf = nil
+	}
+}
@@ -0,0 +1,78 @@
+package shapefile
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNextLazyRecord(t *testing.T) {
+	f1, _ := os.Open(testfile)
+	defer f1.Close()
+	f2, _ := os.Open(testfile)
+	defer f2.Close()
+	s, err := OpenShapefile(f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := OpenShapefile(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		want, err := s.NextRecord()
+		r, lerr := lazy.NextLazyRecord()
+		if err == io.EOF {
+			if lerr != io.EOF {
+				t.Fatalf("expected io.EOF, got %v", lerr)
+			}
+			if i != 299 {
+				t.Errorf("read %d records", i)
+			}
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		} else if lerr != nil {
+			t.Fatal(lerr)
+		}
+		if r.Number != int32(i+1) || r.Type() != want.Type {
+			t.Errorf("record %d: number %d, type %s", i, r.Number, r.Type())
+		}
+		if bounds, ok := r.Bounds(); !ok || bounds != *want.Bounds {
+			t.Errorf("record %d: bounds %v, want %v", i, bounds, want.Bounds)
+		}
+		if i%2 == 1 {
+			r.Release()
+			if _, err = r.Geometry(); err == nil {
+				t.Errorf("record %d: expected error after Release", i)
+			}
+			if i == 1 {
+				for name, fn := range map[string]func(){
+					"Type":   func() { r.Type() },
+					"Bounds": func() { r.Bounds() },
+				} {
+					func() {
+						defer func() {
+							if recover() == nil {
+								t.Errorf("%s did not panic after Release", name)
+							}
+						}()
+						fn()
+					}()
+				}
+			}
+			continue
+		}
+		g, err := r.Geometry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(g, want.Geometry) {
+			t.Errorf("record %d: geometries differ", i)
+		}
+		if bounds, ok := r.Bounds(); !ok || bounds != *want.Bounds {
+			t.Errorf("record %d: bounds after decoding %v", i, bounds)
+		}
+	}
+}
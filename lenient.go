@@ -0,0 +1,129 @@
+package shapefile
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// LenientOptions configures the lenient mode of a Shapefile.
+type LenientOptions struct {
+	// Index holds the entries of the .shx file, which locate the record
+	// following a broken one. Without it, the file is scanned for the
+	// next plausible record header.
+	Index []IndexEntry
+	// Warn, if not nil, is called with every problem that is skipped.
+	Warn func(err error)
+}
+
+// ErrSkipped is the cause of the warnings for records that were passed
+// over while resynchronizing after a broken record.
+var ErrSkipped = errors.New("skipped while resynchronizing")
+
+// SetLenient puts s in lenient mode. Records that cannot be read are
+// then skipped and reported as warnings rather than returned as errors
+// by NextRecord. Errors in the file header still cause OpenShapefile to
+// fail.
+func (s *Shapefile) SetLenient(opts LenientOptions) {
+	s.lenient = &opts
+}
+
+// Warnings returns the problems skipped in lenient mode so far. They are
+// *RecordError.
+func (s *Shapefile) Warnings() []error {
+	return s.warnings
+}
+
+func (s *Shapefile) warn(err error) {
+	s.warnings = append(s.warnings, err)
+	if s.lenient.Warn != nil {
+		s.lenient.Warn(err)
+	}
+}
+
+// recover handles err, returned while reading a record. Outside lenient
+// mode, it returns err. In lenient mode, it records err as a warning and
+// moves to the start of the next record, returning nil, or returns io.EOF
+// if there is none.
+func (s *Shapefile) recover(err error) error {
+	if s.lenient == nil || err == io.EOF {
+		return err
+	}
+	s.warn(err)
+	// the next record may start anywhere after the header of the broken
+	// one, including within the content read for it
+	if k := s.rdr.off - s.last - 8; k > 0 && k <= int64(len(s.buf)) {
+		s.rdr.unread(s.buf[:k])
+		s.buf = nil
+	}
+	if s.lenient.Index != nil {
+		err = s.resyncIndex()
+	} else {
+		err = s.resyncScan()
+	}
+	s.i = s.Header.FileLength - int32(s.rdr.off/2)
+	return err
+}
+
+// resyncIndex moves to the first record after the broken one that has
+// not been read past already.
+func (s *Shapefile) resyncIndex() error {
+	index := s.lenient.Index
+	k := sort.Search(len(index), func(k int) bool {
+		return index[k].Offset > s.last && index[k].Offset >= s.rdr.off
+	})
+	for j := s.n; j < k; j++ {
+		s.warn(&RecordError{Kind: KindShp, Record: j + 1, Offset: index[j].Offset, Err: ErrSkipped})
+	}
+	if k == len(index) {
+		return io.EOF
+	}
+	if _, err := s.rdr.Discard(int(index[k].Offset - s.rdr.off)); err != nil {
+		return io.EOF
+	}
+	s.n = k
+	return nil
+}
+
+// resyncScan moves to the next plausible record header after the header
+// of the broken record: one that is followed by the shape type of the
+// file or a null shape, gives a length that fits the shape type and the
+// file, and a record number past the last one read, but not by more than
+// the number of records (of at least 12 bytes each) that could have been
+// skipped.
+func (s *Shapefile) resyncScan() error {
+	end := 2 * int64(s.Header.FileLength)
+	for start := s.rdr.off; ; {
+		if s.rdr.off+12 > end {
+			return io.EOF
+		}
+		buf, err := s.rdr.Peek(12)
+		if err != nil {
+			return io.EOF
+		}
+		if plausibleHeader(buf, s.Header.ShapeType, s.num, s.rdr.off-s.last, end-s.rdr.off) {
+			// the records in between have been skipped over
+			num := int32(b.Uint32(buf[0:]))
+			for j := s.n + 1; j < int(num); j++ {
+				s.warn(&RecordError{Kind: KindShp, Record: j, Offset: start, Err: ErrSkipped})
+			}
+			s.n = int(num) - 1
+			return nil
+		}
+		if _, err = s.rdr.Discard(1); err != nil {
+			return io.EOF
+		}
+	}
+}
+
+// plausibleHeader reports whether the 12 bytes of buf could start a
+// record of a file of shape type t that follows the record numbered
+// last. buf is found skip bytes after the start of a broken record, and
+// room bytes before the end of the file.
+func plausibleHeader(buf []byte, t ShapeType, last int32, skip, room int64) bool {
+	num := int64(int32(b.Uint32(buf[0:])))
+	length := 2 * int64(b.Uint32(buf[4:]))
+	rt := ShapeType(l.Uint32(buf[8:]))
+	return num > int64(last) && num <= int64(last)+1+skip/12 && 8+length <= room &&
+		(rt == t && length > 4 || rt == NULL_SHAPE && length == 4)
+}
@@ -0,0 +1,187 @@
+package shapefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// brokenFile returns a polygon file of n records, with the shape content
+// of record 3 and the record header of record 5 broken, and its index.
+func brokenFile(t *testing.T, n int) ([]byte, []IndexEntry) {
+	shp, shx := new(memFile), new(memFile)
+	w, err := NewShapefileWriter(shp, shx, POLYGON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err = w.Write(square(float64(i), 0, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, index, err := ReadIndex(shx.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := shp.buf
+	l.PutUint32(data[index[2].Offset+8+36:], 1000)    // NumParts
+	b.PutUint32(data[index[4].Offset+4:], 0x7fffffff) // ContentLength
+	return data, index
+}
+
+func TestLenient(t *testing.T) {
+	for _, withIndex := range []bool{false, true} {
+		data, index := brokenFile(t, 10)
+		s, err := OpenShapefile((&memFile{buf: data}).reader())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = s.NextRecord(); err != nil {
+			t.Fatal(err)
+		}
+		opts := LenientOptions{}
+		if withIndex {
+			opts.Index = index
+		}
+		var warned []error
+		opts.Warn = func(err error) { warned = append(warned, err) }
+		s.SetLenient(opts)
+		var got []float64
+		for {
+			rec, err := s.NextRecord()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, rec.Bounds.Min.X)
+		}
+		want := []float64{1, 3, 5, 6, 7, 8, 9}
+		if len(got) != len(want) {
+			t.Fatalf("index %v: records at %v", withIndex, got)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("index %v: records at %v", withIndex, got)
+				break
+			}
+		}
+		warnings := s.Warnings()
+		if len(warnings) != 2 || len(warned) != 2 {
+			t.Fatalf("index %v: warnings %v", withIndex, warnings)
+		}
+		var rerr *RecordError
+		if !errors.As(warnings[0], &rerr) || rerr.Record != 3 {
+			t.Errorf("index %v: first warning %v", withIndex, warnings[0])
+		}
+		if !errors.As(warnings[1], &rerr) || rerr.Record != 5 {
+			t.Errorf("index %v: second warning %v", withIndex, warnings[1])
+		}
+	}
+}
+
+func TestLenientOversizedLength(t *testing.T) {
+	for _, withIndex := range []bool{false, true} {
+		data, index := brokenFile(t, 10)
+		// record 7 claims the content of records 8 and 9 as well, and cannot
+		// be decoded
+		l.PutUint32(data[index[6].Offset+8+36:], 1000)
+		b.PutUint32(data[index[6].Offset+4:], uint32(index[9].Offset-index[6].Offset-8)/2)
+		s, err := OpenShapefile((&memFile{buf: data}).reader())
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := LenientOptions{}
+		if withIndex {
+			opts.Index = index
+		}
+		s.SetLenient(opts)
+		var got []float64
+		for {
+			rec, err := s.NextRecord()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, rec.Bounds.Min.X)
+		}
+		want := []float64{0, 1, 3, 5, 7, 8, 9}
+		if len(got) != len(want) {
+			t.Fatalf("index %v: records at %v, want %v", withIndex, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("index %v: records at %v, want %v", withIndex, got, want)
+			}
+		}
+		if n := len(s.Warnings()); n != 3 {
+			t.Errorf("index %v: %d warnings: %v", withIndex, n, s.Warnings())
+		}
+	}
+}
+
+func TestLenientFeatures(t *testing.T) {
+	dbfFile := new(memFile)
+	w, err := NewDBFWriter(dbfFile, []FieldDescriptor{NewFieldDescriptor("ID", Number, 4, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err = w.Write([]interface{}{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, withIndex := range []bool{false, true} {
+		open := func() (*Shapefile, *DBFFile) {
+			data, index := brokenFile(t, 10)
+			s, err := OpenShapefile((&memFile{buf: data}).reader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := LenientOptions{}
+			if withIndex {
+				opts.Index = index
+			}
+			s.SetLenient(opts)
+			dbf, err := OpenDBFFile(dbfFile.reader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s, dbf
+		}
+		// the squares of the records are at x = ID
+		check := func(rec *ShapefileRecord, row []interface{}) {
+			if fmt.Sprint(row[0]) != fmt.Sprint(rec.Bounds.Min.X) {
+				t.Errorf("index %v: record at %g paired with row %v", withIndex, rec.Bounds.Min.X, row)
+			}
+		}
+		n := 0
+		s, dbf := open()
+		for f, err := range Features(context.Background(), s, dbf) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			check(f.Record, f.Row)
+			n++
+		}
+		if n != 8 {
+			t.Errorf("index %v: %d features", withIndex, n)
+		}
+		layer, err := ReadLayer(open())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, rec := range layer.Records {
+			check(rec, layer.Rows[i])
+		}
+	}
+}
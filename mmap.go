@@ -0,0 +1,352 @@
+package shapefile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// source gives access to the bytes of a file.
+type source interface {
+	// at returns the n bytes at off. For memory-mapped files the result
+	// is a view of the mapping; otherwise it is a copy.
+	at(off int64, n int) ([]byte, error)
+	size() int64
+	io.Closer
+}
+
+// readerAtSource is a source that reads from an io.ReaderAt. It is used
+// where files cannot be memory-mapped.
+type readerAtSource struct {
+	r io.ReaderAt
+	n int64
+	c io.Closer // may be nil
+}
+
+func (s *readerAtSource) at(off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 || off+int64(n) > s.n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, n)
+	if _, err := s.r.ReadAt(buf, off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (s *readerAtSource) size() int64 { return s.n }
+
+func (s *readerAtSource) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
+
+// sourceReader reads a source through io.ReaderAt.
+type sourceReader struct{ source }
+
+func (r sourceReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size() {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), r.size()-off))
+	buf, err := r.at(off, n)
+	if err != nil {
+		return 0, err
+	}
+	copy(p, buf)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// mappedSource is a source backed by a byte slice, usually a memory
+// mapping.
+type mappedSource struct {
+	data  []byte
+	unmap func() error // may be nil
+}
+
+func (s *mappedSource) at(off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 || off+int64(n) > int64(len(s.data)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return s.data[off : off+int64(n) : off+int64(n)], nil
+}
+
+func (s *mappedSource) size() int64 { return int64(len(s.data)) }
+
+func (s *mappedSource) Close() error {
+	if s.unmap == nil {
+		return nil
+	}
+	err := s.unmap()
+	s.data, s.unmap = nil, nil
+	return err
+}
+
+// MappedShapefile gives random access to the records of a shapefile set.
+// Opened with OpenMapped on Linux, the files are memory-mapped, and
+// counting records, reading their bounds or slicing out their content
+// does not allocate.
+type MappedShapefile struct {
+	Header  *ShapefileHeader
+	DBF     *DBFFile // nil if there is no .dbf file
+	shp     source
+	shx     source  // nil if there is no .shx file
+	dbf     source  // nil if there is no .dbf file
+	offsets []int64 // record offsets, if there is no .shx file
+	records int     // number of records
+
+	orientation Orientation
+}
+
+// OpenMapped opens basename.shp and, if they exist, basename.shx and
+// basename.dbf. Without a .shx file, the .shp file is scanned once to
+// locate its records.
+func OpenMapped(basename string) (m *MappedShapefile, err error) {
+	m = new(MappedShapefile)
+	defer func() {
+		if err != nil {
+			m.Close()
+			m = nil
+		}
+	}()
+	open := func(ext string, required bool) (source, error) {
+		f, err := os.Open(basename + ext)
+		if os.IsNotExist(err) && !required {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return mapFile(f)
+	}
+	if m.shp, err = open(".shp", true); err != nil {
+		return
+	}
+	if m.shx, err = open(".shx", false); err != nil {
+		return
+	}
+	if m.dbf, err = open(".dbf", false); err != nil {
+		return
+	}
+	err = m.init()
+	return
+}
+
+// NewMappedShapefile reads a shapefile set through io.ReaderAt, for
+// platforms or inputs where memory-mapping is not available. Each
+// reader comes with the size of its file in bytes. Record content is
+// then copied out of the readers. shx and dbf may be nil.
+func NewMappedShapefile(shp io.ReaderAt, shpSize int64, shx io.ReaderAt, shxSize int64,
+	dbf io.ReaderAt, dbfSize int64) (m *MappedShapefile, err error) {
+	m = &MappedShapefile{shp: &readerAtSource{r: shp, n: shpSize}}
+	if shx != nil {
+		m.shx = &readerAtSource{r: shx, n: shxSize}
+	}
+	if dbf != nil {
+		m.dbf = &readerAtSource{r: dbf, n: dbfSize}
+	}
+	if err = m.init(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (m *MappedShapefile) init() (err error) {
+	var buf []byte
+	if buf, err = m.shp.at(0, 100); err != nil {
+		return &HeaderError{Kind: KindShp, Err: err}
+	}
+	if m.Header, err = newShapefileHeaderFromReader(bytes.NewReader(buf), KindShp); err != nil {
+		return
+	}
+	if m.shx == nil {
+		if err = m.scan(); err != nil {
+			return
+		}
+		m.records = len(m.offsets)
+	} else if m.records, err = m.index(); err != nil {
+		return
+	}
+	if m.dbf != nil {
+		r := io.NewSectionReader(sourceReader{m.dbf}, 0, m.dbf.size())
+		if m.DBF, err = OpenDBFFile(r); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// scan locates the records of the .shp file by walking their headers.
+func (m *MappedShapefile) scan() error {
+	end := min(2*int64(m.Header.FileLength), m.shp.size())
+	for off := int64(100); off+8 <= end; {
+		buf, err := m.shp.at(off, 8)
+		if err != nil {
+			return &RecordError{Kind: KindShp, Record: len(m.offsets) + 1, Offset: off, Err: err}
+		}
+		m.offsets = append(m.offsets, off)
+		off += 8 + 2*int64(b.Uint32(buf[4:]))
+	}
+	return nil
+}
+
+// index checks the header of the .shx file against its size and
+// returns the number of records it lists.
+func (m *MappedShapefile) index() (n int, err error) {
+	var buf []byte
+	if buf, err = m.shx.at(0, 100); err != nil {
+		return 0, &HeaderError{Kind: KindShx, Err: err}
+	}
+	var hdr *ShapefileHeader
+	if hdr, err = newShapefileHeaderFromReader(bytes.NewReader(buf), KindShx); err != nil {
+		return
+	}
+	if hdr.FileLength < 50 || 2*int64(hdr.FileLength) > m.shx.size() {
+		return 0, &HeaderError{Kind: KindShx, Field: "FileLength", Offset: 24,
+			Err: &LengthError{Field: "FileLength", Value: int64(hdr.FileLength),
+				Min: 50, Max: m.shx.size() / 2}}
+	}
+	return int(hdr.FileLength-50) / 4, nil // each entry is 8 bytes = 4 words
+}
+
+// NumRecords returns the number of records in the .shp file.
+func (m *MappedShapefile) NumRecords() int {
+	return m.records
+}
+
+// SetOrientation sets how the rings of polygons are oriented by the
+// Decode method of the views returned by Record.
+func (m *MappedShapefile) SetOrientation(o Orientation) {
+	m.orientation = o
+}
+
+// Record returns a view of record i, counting from zero.
+func (m *MappedShapefile) Record(i int) (v RecordView, err error) {
+	if i < 0 || i >= m.NumRecords() {
+		return v, fmt.Errorf("record %d out of range", i)
+	}
+	v.index, v.orientation = i, m.orientation
+	if m.shx == nil {
+		v.Offset = m.offsets[i]
+	} else {
+		var buf []byte
+		if buf, err = m.shx.at(100+8*int64(i), 8); err != nil {
+			return v, &RecordError{Kind: KindShx, Record: i + 1, Offset: 100 + 8*int64(i), Err: err}
+		}
+		v.Offset = parseIndexEntry(buf).Offset
+	}
+	var hdr []byte
+	if hdr, err = m.shp.at(v.Offset, 8); err != nil {
+		return v, &RecordError{Kind: KindShp, Record: i + 1, Offset: v.Offset, Err: err}
+	}
+	v.Number = int32(b.Uint32(hdr[0:]))
+	if v.Content, err = m.shp.at(v.Offset+8, 2*int(b.Uint32(hdr[4:]))); err != nil {
+		return v, &RecordError{Kind: KindShp, Record: i + 1, Offset: v.Offset, Err: err}
+	}
+	return
+}
+
+// Row returns the attributes of record i, counting from zero. The row
+// of a deleted record is nil.
+func (m *MappedShapefile) Row(i int) ([]interface{}, error) {
+	if m.DBF == nil {
+		return nil, fmt.Errorf("no dbf file")
+	}
+	hdr := m.DBF.DBFFileHeader
+	if i < 0 || i >= int(hdr.NumRecords) {
+		return nil, fmt.Errorf("row %d out of range", i)
+	}
+	raw, err := m.dbf.at(m.DBF.rowOffset(i), int(hdr.LenRecord))
+	if err != nil {
+		return nil, &RecordError{Kind: KindDbf, Record: i + 1, Offset: m.DBF.rowOffset(i), Err: err}
+	}
+	return m.DBF.parseRecord(i, raw), nil
+}
+
+// Close releases the underlying files. Record views must not be used
+// afterwards.
+func (m *MappedShapefile) Close() (err error) {
+	for _, s := range []source{m.shp, m.shx, m.dbf} {
+		if s != nil {
+			if cerr := s.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	return
+}
+
+// RecordView is the undecoded content of a record.
+type RecordView struct {
+	Number  int32  // record number, counting from one
+	Offset  int64  // byte offset of the record header
+	Content []byte // record content, starting with the shape type
+
+	index       int // position in the file, counting from zero
+	orientation Orientation
+}
+
+// Type returns the shape type of the record.
+func (v RecordView) Type() ShapeType {
+	if len(v.Content) < 4 {
+		return NULL_SHAPE
+	}
+	return ShapeType(l.Uint32(v.Content))
+}
+
+// Bounds returns the bounding box stored in the record, or the location
+// of a point record. ok is false for null shapes.
+func (v RecordView) Bounds() (bounds geom.Bounds, ok bool) {
+	f := func(i int) float64 {
+		return math.Float64frombits(l.Uint64(v.Content[4+8*i:]))
+	}
+	switch v.Type().baseType() {
+	case POINT:
+		if len(v.Content) < 20 {
+			return
+		}
+		bounds.Min = geom.Point{X: f(0), Y: f(1)}
+		bounds.Max = bounds.Min
+	case MULTI_POINT, POLY_LINE, POLYGON:
+		if len(v.Content) < 36 {
+			return
+		}
+		bounds.Min = geom.Point{X: f(0), Y: f(1)}
+		bounds.Max = geom.Point{X: f(2), Y: f(3)}
+	default:
+		return
+	}
+	return bounds, true
+}
+
+// Decode decodes the geometry of the record. Views returned by a
+// MappedShapefile orient polygons as set by its SetOrientation method.
+func (v RecordView) Decode() (rec *ShapefileRecord, err error) {
+	rec = &ShapefileRecord{header: &shapefileRecordHeader{
+		RecordNumber:  v.Number,
+		ContentLength: int32(len(v.Content) / 2),
+	}, offset: v.Offset, index: v.index}
+	if err = rec.recordContent(v.Content, v.orientation); err != nil {
+		err = &RecordError{Kind: KindShp, Record: int(v.Number), Offset: v.Offset, Err: err}
+	}
+	return
+}
+
+// Shape decodes the record into the layout of the shapefile
+// specification, orienting polygons like Decode.
+func (v RecordView) Shape() (*Shape, error) {
+	s, err := decodeShape(v.Content)
+	if err != nil {
+		return nil, &RecordError{Kind: KindShp, Record: int(v.Number), Offset: v.Offset, Err: err}
+	}
+	s.orient(v.orientation, false)
+	return s, nil
+}
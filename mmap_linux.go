@@ -0,0 +1,28 @@
+//go:build linux
+
+package shapefile
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile memory-maps f for reading. f is closed once it is mapped.
+func mapFile(f *os.File) (source, error) {
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return &mappedSource{}, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()),
+		syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &mappedSource{data: data, unmap: func() error {
+		return syscall.Munmap(data)
+	}}, nil
+}
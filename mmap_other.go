@@ -0,0 +1,16 @@
+//go:build !linux
+
+package shapefile
+
+import "os"
+
+// mapFile falls back to reading f through io.ReaderAt on platforms
+// without memory-mapping support.
+func mapFile(f *os.File) (source, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &readerAtSource{r: f, n: fi.Size(), c: f}, nil
+}
@@ -0,0 +1,143 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+const testBasename = "test/Geometrie_Wahlkreise_18DBT"
+
+func TestOpenMapped(t *testing.T) {
+	m, err := OpenMapped(testBasename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.NumRecords() != 299 {
+		t.Fatalf("found %d records", m.NumRecords())
+	}
+
+	file, _ := os.Open(testfile)
+	defer file.Close()
+	s, err := OpenShapefile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		want, err := s.NextRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := m.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Number != int32(i+1) || v.Type() != POLYGON {
+			t.Errorf("record %d: number %d, type %s", i, v.Number, v.Type())
+		}
+		if bounds, ok := v.Bounds(); !ok || bounds != *want.Bounds {
+			t.Errorf("record %d: bounds %v, want %v", i, bounds, want.Bounds)
+		}
+		got, err := v.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Geometry, want.Geometry) {
+			t.Errorf("record %d: geometries differ", i)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		v, _ := m.Record(42)
+		v.Bounds()
+	})
+	if allocs != 0 {
+		t.Errorf("Record and Bounds allocate %v times", allocs)
+	}
+
+	row, err := m.Row(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(row) != 4 {
+		t.Errorf("unexpected row: %v", row)
+	}
+
+	// the DBFFile reads rows from the mapping as well
+	if got, err := m.DBF.ReadRow(0); err != nil || !reflect.DeepEqual(got, row) {
+		t.Errorf("ReadRow(0) = %v, %v, want %v", got, err, row)
+	}
+	if got, err := m.DBF.NextRecord(); err != nil || !reflect.DeepEqual(got, row) {
+		t.Errorf("NextRecord() = %v, %v, want %v", got, err, row)
+	}
+	numbers, err := m.DBF.IntColumn("WKR_NR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(numbers) != 299 || numbers[0] != 1 || numbers[298] != 299 {
+		t.Errorf("unexpected column: %d values, %v", len(numbers), numbers[:min(3, len(numbers))])
+	}
+}
+
+func TestNewMappedShapefile(t *testing.T) {
+	file, _ := os.Open(testfile)
+	defer file.Close()
+	fi, _ := file.Stat()
+	m, err := NewMappedShapefile(file, fi.Size(), nil, 0, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.NumRecords() != 299 {
+		t.Errorf("found %d records", m.NumRecords())
+	}
+	if _, err = m.Row(0); err == nil {
+		t.Errorf("expected error without dbf")
+	}
+}
+
+func TestNewMappedShapefileIndex(t *testing.T) {
+	shp, shx := new(memFile), new(memFile)
+	w, err := NewShapefileWriter(shp, shx, POINT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = w.Write(geom.Point{X: float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	open := func(shx []byte) (*MappedShapefile, error) {
+		return NewMappedShapefile(bytes.NewReader(shp.buf), int64(len(shp.buf)),
+			bytes.NewReader(shx), int64(len(shx)), nil, 0)
+	}
+	m, err := open(shx.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.NumRecords() != 3 {
+		t.Errorf("found %d records", m.NumRecords())
+	}
+
+	// the header claims more entries than the file holds
+	var herr *HeaderError
+	if _, err = open(shx.buf[:len(shx.buf)-8]); !errors.As(err, &herr) || herr.Field != "FileLength" {
+		t.Errorf("truncated index: got %v", err)
+	}
+	short := append([]byte(nil), shx.buf...)
+	binary.BigEndian.PutUint32(short[24:], 10)
+	if _, err = open(short); !errors.As(err, &herr) || herr.Field != "FileLength" {
+		t.Errorf("short file length: got %v", err)
+	}
+	if _, err = open(shx.buf[:60]); !errors.As(err, &herr) || herr.Kind != KindShx {
+		t.Errorf("truncated header: got %v", err)
+	}
+}
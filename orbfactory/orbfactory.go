@@ -0,0 +1,113 @@
+// Package orbfactory reads and writes shapefile records as
+// github.com/paulmach/orb geometries:
+//
+//	r := shapefile.NewReader(shp, orbfactory.Factory{})
+//	g, err := r.Next()
+//
+// orb geometries are planar, so Z and M values are dropped when reading
+// and written as zero.
+package orbfactory
+
+import (
+	"fmt"
+
+	"github.com/ctessum/shapefile"
+	"github.com/paulmach/orb"
+)
+
+// Factory is a shapefile.Factory for orb geometries. Null shapes are
+// nil. Points and multipoints become orb.Point and orb.MultiPoint,
+// polylines orb.MultiLineString, and polygons orb.Polygon, or
+// orb.MultiPolygon if they have several exterior rings.
+//
+// When writing, orb.LineString is accepted as a polyline and orb.Ring
+// as a polygon.
+type Factory struct{}
+
+func (Factory) Geometry(s *shapefile.Shape) (orb.Geometry, error) {
+	points := func(start, end int) []orb.Point {
+		pts := make([]orb.Point, end-start)
+		for i, p := range s.Points[start:end] {
+			pts[i] = orb.Point{p.X, p.Y}
+		}
+		return pts
+	}
+	switch s.Type {
+	case shapefile.NULL_SHAPE:
+		return nil, nil
+	case shapefile.POINT, shapefile.POINT_Z, shapefile.POINT_M:
+		return orb.Point{s.Points[0].X, s.Points[0].Y}, nil
+	case shapefile.MULTI_POINT, shapefile.MULTI_POINT_Z, shapefile.MULTI_POINT_M:
+		return orb.MultiPoint(points(0, len(s.Points))), nil
+	case shapefile.POLY_LINE, shapefile.POLY_LINE_Z, shapefile.POLY_LINE_M:
+		mls := make(orb.MultiLineString, len(s.Parts))
+		for i := range s.Parts {
+			mls[i] = points(s.Part(i))
+		}
+		return mls, nil
+	case shapefile.POLYGON, shapefile.POLYGON_Z, shapefile.POLYGON_M:
+		polygons := s.Polygons()
+		mp := make(orb.MultiPolygon, len(polygons))
+		for i, rings := range polygons {
+			mp[i] = make(orb.Polygon, len(rings))
+			for j, r := range rings {
+				mp[i][j] = points(s.Part(r))
+			}
+		}
+		if len(mp) == 1 {
+			return mp[0], nil
+		}
+		return mp, nil
+	}
+	return nil, fmt.Errorf("unsupported shape type: %s", s.Type)
+}
+
+func (Factory) Shape(g orb.Geometry) (*shapefile.Shape, error) {
+	s := new(shapefile.Shape)
+	add := func(pts []orb.Point) {
+		if len(pts) == 0 {
+			return
+		}
+		s.Parts = append(s.Parts, int32(len(s.Points)))
+		for _, p := range pts {
+			s.Points = append(s.Points, shapefile.Point{X: p[0], Y: p[1]})
+		}
+	}
+	switch g := g.(type) {
+	case nil:
+		s.Type = shapefile.NULL_SHAPE
+	case orb.Point:
+		s.Type = shapefile.POINT
+		s.Points = []shapefile.Point{{X: g[0], Y: g[1]}}
+	case orb.MultiPoint:
+		s.Type = shapefile.MULTI_POINT
+		add(g)
+		s.Parts = nil
+	case orb.LineString:
+		s.Type = shapefile.POLY_LINE
+		add(g)
+	case orb.MultiLineString:
+		s.Type = shapefile.POLY_LINE
+		for _, ls := range g {
+			add(ls)
+		}
+	case orb.Ring:
+		s.Type = shapefile.POLYGON
+		add(g)
+	case orb.Polygon:
+		s.Type = shapefile.POLYGON
+		for _, r := range g {
+			add(r)
+		}
+	case orb.MultiPolygon:
+		s.Type = shapefile.POLYGON
+		for _, pg := range g {
+			for _, r := range pg {
+				add(r)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type: %T", g)
+	}
+	return s, nil
+}
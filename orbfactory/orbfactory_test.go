@@ -0,0 +1,52 @@
+package orbfactory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ctessum/shapefile"
+	"github.com/paulmach/orb"
+)
+
+func TestRoundTrip(t *testing.T) {
+	square := func(x, y, size float64) []shapefile.Point {
+		return []shapefile.Point{{X: x, Y: y}, {X: x, Y: y + size},
+			{X: x + size, Y: y + size}, {X: x + size, Y: y}, {X: x, Y: y}}
+	}
+	pts := append(append(square(0, 0, 1), square(5, 5, 1)...), square(5.2, 5.2, 0.5)...)
+	tests := []struct {
+		s    *shapefile.Shape
+		want orb.Geometry
+	}{
+		{&shapefile.Shape{Type: shapefile.NULL_SHAPE}, nil},
+		{&shapefile.Shape{Type: shapefile.POINT, Points: pts[:1]}, orb.Point{0, 0}},
+		{&shapefile.Shape{Type: shapefile.MULTI_POINT, Points: pts[:3]},
+			orb.MultiPoint{{0, 0}, {0, 1}, {1, 1}}},
+		{&shapefile.Shape{Type: shapefile.POLYGON, Parts: []int32{0}, Points: pts[:5]},
+			orb.Polygon{{{0, 0}, {0, 1}, {1, 1}, {1, 0}, {0, 0}}}},
+		{&shapefile.Shape{Type: shapefile.POLYGON, Parts: []int32{0, 5, 10}, Points: pts},
+			orb.MultiPolygon{
+				{{{0, 0}, {0, 1}, {1, 1}, {1, 0}, {0, 0}}},
+				{{{5, 5}, {5, 6}, {6, 6}, {6, 5}, {5, 5}},
+					{{5.2, 5.2}, {5.2, 5.7}, {5.7, 5.7}, {5.7, 5.2}, {5.2, 5.2}}},
+			}},
+	}
+	var f Factory
+	for _, test := range tests {
+		g, err := f.Geometry(test.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(g, test.want) {
+			t.Errorf("%s: got %v, want %v", test.s.Type, g, test.want)
+		}
+		s, err := f.Shape(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Type != test.s.Type || !reflect.DeepEqual(s.Parts, test.s.Parts) ||
+			!reflect.DeepEqual(s.Points, test.s.Points) {
+			t.Errorf("%s: got %+v, want %+v", test.s.Type, s, test.s)
+		}
+	}
+}
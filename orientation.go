@@ -0,0 +1,116 @@
+package shapefile
+
+import (
+	"github.com/ctessum/geomop"
+	"github.com/twpayne/gogeom/geom"
+)
+
+// Orientation is a policy for the winding direction of polygon rings. It
+// applies the same way to POLYGON, POLYGON_Z and POLYGON_M records.
+type Orientation int
+
+const (
+	// DefaultOrientation orients rings the way geomop.FixOrientation
+	// does when reading, and like ClockwiseExterior when writing.
+	DefaultOrientation Orientation = iota
+	// FileOrientation keeps rings as they are in the file when reading,
+	// and as they are given when writing.
+	FileOrientation
+	// RightHandRule orients exterior rings counter-clockwise and holes
+	// clockwise, as OGC simple features and RFC 7946 do.
+	RightHandRule
+	// ClockwiseExterior orients exterior rings clockwise and holes
+	// counter-clockwise, as the shapefile specification does.
+	ClockwiseExterior
+)
+
+func (o Orientation) String() string {
+	switch o {
+	case DefaultOrientation:
+		return "default"
+	case FileOrientation:
+		return "file"
+	case RightHandRule:
+		return "right-hand rule"
+	case ClockwiseExterior:
+		return "clockwise exterior"
+	default:
+		return "unknown"
+	}
+}
+
+// ringReverse reports for each ring of the polygonal geometry g, in the
+// order of geomParts, whether it must be reversed to follow o. write
+// selects the meaning of DefaultOrientation.
+func ringReverse(g geom.T, o Orientation, write bool) []bool {
+	return ringsReverse(geomParts(g), o, write)
+}
+
+// ringsReverse is ringReverse for the rings of a polygon.
+func ringsReverse(rings [][]geom.Point, o Orientation, write bool) []bool {
+	switch o {
+	case FileOrientation:
+		return make([]bool, len(rings))
+	case RightHandRule:
+		reverse := esriReverse(rings)
+		for i := range reverse {
+			reverse[i] = !reverse[i]
+		}
+		return reverse
+	case DefaultOrientation:
+		if !write {
+			return geomopReverse(rings)
+		}
+	}
+	return esriReverse(rings)
+}
+
+// geomopReverse reports which rings geomop.FixOrientation reverses.
+func geomopReverse(rings [][]geom.Point) []bool {
+	pg := geom.Polygon{Rings: make([][]geom.Point, len(rings))}
+	for i, r := range rings {
+		pg.Rings[i] = append([]geom.Point(nil), r...)
+	}
+	geomop.FixOrientation(pg)
+	reverse := make([]bool, len(rings))
+	for i, r := range rings {
+		before, after := signedArea(r), signedArea(pg.Rings[i])
+		reverse[i] = before != 0 && after != 0 && (before > 0) != (after > 0)
+	}
+	return reverse
+}
+
+// orientRings reverses, in place, the rings of g that do not follow o
+// when reading. Other geometries are left alone.
+func orientRings(g geom.T, o Orientation) {
+	if o == FileOrientation || !isPolygonal(g) {
+		return
+	}
+	reverse := ringReverse(g, o, false)
+	switch t := g.(type) {
+	case geom.Polygon:
+		reverseRings(t.Rings, reverse)
+	case geom.MultiPolygon:
+		for _, pg := range t.Polygons {
+			reverseRings(pg.Rings, reverse)
+			reverse = reverse[len(pg.Rings):]
+		}
+	case geom.PolygonZ:
+		reverseRings(t.Rings, reverse)
+	case geom.PolygonM:
+		reverseRings(t.Rings, reverse)
+	case geom.PolygonZM:
+		reverseRings(t.Rings, reverse)
+	}
+}
+
+func reverseRings[P any](rings [][]P, reverse []bool) {
+	for i, r := range rings {
+		if !reverse[i] {
+			continue
+		}
+		for a, b := 0, len(r)-1; a < b; a, b = a+1, b-1 {
+			r[a], r[b] = r[b], r[a]
+		}
+	}
+}
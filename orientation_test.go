@@ -0,0 +1,65 @@
+package shapefile
+
+import (
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+func TestOrientation(t *testing.T) {
+	// counter-clockwise exterior and hole
+	outer, hole := square(0, 0, 3).Rings[0], square(1, 1, 1).Rings[0]
+	zm := func(r []geom.Point) []geom.PointZM {
+		out := make([]geom.PointZM, len(r))
+		for i, p := range r {
+			out[i] = geom.PointZM{X: p.X, Y: p.Y, Z: float64(i), M: float64(i)}
+		}
+		return out
+	}
+	geoms := map[ShapeType]geom.T{
+		POLYGON:   geom.Polygon{Rings: [][]geom.Point{outer, hole}},
+		POLYGON_Z: geom.PolygonZM{Rings: [][]geom.PointZM{zm(outer), zm(hole)}},
+	}
+	for typ, g := range geoms {
+		shp := new(memFile)
+		w, err := NewShapefileWriter(shp, nil, typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.SetOrientation(FileOrientation)
+		if err = w.Write(g); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for o, ccw := range map[Orientation][2]bool{
+			FileOrientation:   {true, true},
+			RightHandRule:     {true, false},
+			ClockwiseExterior: {false, true},
+		} {
+			s, err := OpenShapefile(shp.reader())
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.SetOrientation(o)
+			rec, err := s.NextRecord()
+			if err != nil {
+				t.Fatal(err)
+			}
+			rings := geomParts(rec.Geometry)
+			for i, r := range rings {
+				if signedArea(r) > 0 != ccw[i] {
+					t.Errorf("%s, %s: ring %d counter-clockwise is %v, want %v",
+						typ, o, i, !ccw[i], ccw[i])
+				}
+			}
+			if pg, ok := rec.Geometry.(geom.PolygonZM); ok && !ccw[0] {
+				// Z and M values follow their points
+				if r := pg.Rings[0]; r[1].Z != 3 || r[1].M != 3 {
+					t.Errorf("%s: reversed point %v", o, r[1])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package shapefile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ctessum/geomop"
+	"github.com/twpayne/gogeom/geom"
+)
+
+// OverlayOp selects the parts of two polygon layers kept by Overlay.
+type OverlayOp int
+
+const (
+	OverlayIntersection  OverlayOp = iota // areas covered by both layers
+	OverlayUnion                          // areas covered by either layer
+	OverlayDifference                     // areas covered by the first layer only
+	OverlaySymDifference                  // areas covered by exactly one layer
+)
+
+func (op OverlayOp) String() string {
+	switch op {
+	case OverlayIntersection:
+		return "INTERSECTION"
+	case OverlayUnion:
+		return "UNION"
+	case OverlayDifference:
+		return "DIFFERENCE"
+	case OverlaySymDifference:
+		return "SYM_DIFFERENCE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// OverlayOptions configures Overlay.
+type OverlayOptions struct {
+	Op OverlayOp
+	// PrefixA and PrefixB are prepended to the field names of the first
+	// and second layer in the output. Names are then shortened and made
+	// unique to fit the 10 byte DBF limit.
+	PrefixA, PrefixB string
+}
+
+// Overlay combines the polygons of layers a and b. Every output feature
+// is a piece of the plane covered by at most one feature of each layer,
+// and carries the attributes of those features; attributes of a layer
+// that does not cover the piece are blank. Difference output carries
+// the attributes of a only.
+func Overlay(a, b *Layer, opts OverlayOptions) (out *Layer, err error) {
+	out = &Layer{Type: POLYGON}
+	used := make(map[string]bool)
+	for _, fd := range a.Fields {
+		name := uniqueFieldName(opts.PrefixA+fd.fieldName(), used)
+		out.Fields = append(out.Fields, renameField(fd, name))
+	}
+	withB := opts.Op != OverlayDifference
+	if withB {
+		for _, fd := range b.Fields {
+			name := uniqueFieldName(opts.PrefixB+fd.fieldName(), used)
+			out.Fields = append(out.Fields, renameField(fd, name))
+		}
+	}
+	blankA := make([]interface{}, len(a.Fields))
+	blankB := make([]interface{}, len(b.Fields))
+	rowOf := func(layer *Layer, i int, blank []interface{}) []interface{} {
+		if layer.Rows[i] == nil {
+			return blank
+		}
+		return layer.Rows[i]
+	}
+	emit := func(g geom.T, rows ...[]interface{}) {
+		rec := &ShapefileRecord{Type: POLYGON, Geometry: g, Bounds: geomBounds(g)}
+		if !withB {
+			rows = rows[:1]
+		}
+		out.add(rec, rows...)
+	}
+
+	idxB := b.index()
+	for i, rec := range a.Records {
+		if !isPolygonal(rec.Geometry) {
+			continue
+		}
+		ga := flatPolygon(rec.Geometry)
+		var pieces []overlayPiece
+		var rest geom.T
+		if pieces, rest, err = overlayPieces(ga, b, idxB, opts.Op == OverlayIntersection ||
+			opts.Op == OverlayUnion, opts.Op != OverlayIntersection); err != nil {
+			return nil, fmt.Errorf("%s: first layer record %d: %v", opts.Op, i+1, err)
+		}
+		for _, p := range pieces {
+			emit(p.g, rowOf(a, i, blankA), rowOf(b, p.other, blankB))
+		}
+		if rest != nil {
+			emit(rest, rowOf(a, i, blankA), blankB)
+		}
+	}
+	if opts.Op != OverlayUnion && opts.Op != OverlaySymDifference {
+		return out, nil
+	}
+	idxA := a.index()
+	for j, rec := range b.Records {
+		if !isPolygonal(rec.Geometry) {
+			continue
+		}
+		var rest geom.T
+		if _, rest, err = overlayPieces(flatPolygon(rec.Geometry), a, idxA,
+			false, true); err != nil {
+			return nil, fmt.Errorf("%s: second layer record %d: %v", opts.Op, j+1, err)
+		}
+		if rest != nil {
+			emit(rest, blankA, rowOf(b, j, blankB))
+		}
+	}
+	return out, nil
+}
+
+// overlayPiece is the intersection of a polygon with feature other of
+// the other layer.
+type overlayPiece struct {
+	g     geom.T
+	other int
+}
+
+// overlayPieces splits g by the polygons of other. If intersections is
+// set, it returns the non-empty intersections with each overlapping
+// feature, in file order. If remainder is set, rest is the part of g
+// not covered by other, or nil if there is none.
+func overlayPieces(g geom.T, other *Layer, idx *gridIndex,
+	intersections, remainder bool) (pieces []overlayPiece, rest geom.T, err error) {
+	var candidates []int
+	idx.query(geomBounds(g), func(k int) {
+		candidates = append(candidates, k)
+	})
+	sort.Ints(candidates)
+	if remainder {
+		rest = g
+	}
+	for _, k := range candidates {
+		og := other.Records[k].Geometry
+		if !isPolygonal(og) {
+			continue
+		}
+		og = flatPolygon(og)
+		if intersections {
+			var p geom.T
+			if p, err = geomop.Construct(g, og, geomop.INTERSECTION); err != nil {
+				return
+			}
+			if p != nil && geomop.Area(p) > 0 {
+				pieces = append(pieces, overlayPiece{g: p, other: k})
+			}
+		}
+		if rest == nil {
+			continue
+		}
+		if rest, err = geomop.Construct(rest, og, geomop.DIFFERENCE); err != nil {
+			return
+		}
+		if rest != nil && geomop.Area(rest) == 0 {
+			rest = nil
+		}
+	}
+	return
+}
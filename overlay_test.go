@@ -0,0 +1,89 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// rect returns a counter-clockwise rectangle.
+func rect(x0, y0, x1, y1 float64) geom.Polygon {
+	return geom.Polygon{Rings: [][]geom.Point{{
+		{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1}, {X: x0, Y: y1}, {X: x0, Y: y0},
+	}}}
+}
+
+// shapeOf returns the area of a polygonal geometry and the number of
+// its outer rings.
+func shapeOf(g geom.T) (area float64, parts int) {
+	rings := geomParts(g)
+	for i, r := range rings {
+		if ringIsHole(rings, i) {
+			area -= math.Abs(signedArea(r))
+		} else {
+			area += math.Abs(signedArea(r))
+			parts++
+		}
+	}
+	return
+}
+
+func TestOverlay(t *testing.T) {
+	a := &Layer{Type: POLYGON, Fields: []FieldDescriptor{NewFieldDescriptor("NAME", Character, 4, 0)}}
+	a.add(&ShapefileRecord{Geometry: square(0, 0, 3)}, []interface{}{"a1"})
+	a.add(&ShapefileRecord{Geometry: square(10, 0, 1)}, []interface{}{"a2"})
+	// a strip across a1, cutting it in two and sticking out on both sides
+	b := &Layer{Type: POLYGON, Fields: []FieldDescriptor{NewFieldDescriptor("NAME", Character, 4, 0)}}
+	b.add(&ShapefileRecord{Geometry: rect(1, -1, 2, 4)}, []interface{}{"b1"})
+
+	tests := []struct {
+		opts   OverlayOptions
+		fields []string
+		want   []string // attributes, area and outer rings of each feature
+	}{
+		{OverlayOptions{Op: OverlayIntersection}, []string{"NAME", "NAME1"},
+			[]string{"a1 b1 3 1"}},
+		{OverlayOptions{Op: OverlayUnion, PrefixA: "A_", PrefixB: "B_"}, []string{"A_NAME", "B_NAME"},
+			[]string{"a1 b1 3 1", "a1 <nil> 6 2", "a2 <nil> 1 1", "<nil> b1 2 2"}},
+		{OverlayOptions{Op: OverlayDifference, PrefixA: "A_", PrefixB: "B_"}, []string{"A_NAME"},
+			[]string{"a1 6 2", "a2 1 1"}},
+		{OverlayOptions{Op: OverlaySymDifference}, []string{"NAME", "NAME1"},
+			[]string{"a1 <nil> 6 2", "a2 <nil> 1 1", "<nil> b1 2 2"}},
+	}
+	for _, test := range tests {
+		out, err := Overlay(a, b, test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.opts.Op, err)
+			continue
+		}
+		var fields []string
+		for _, fd := range out.Fields {
+			fields = append(fields, fd.fieldName())
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%s: fields %q, want %q", test.opts.Op, fields, test.fields)
+		}
+		var got []string
+		for i, rec := range out.Records {
+			area, parts := shapeOf(rec.Geometry)
+			s := ""
+			for _, v := range out.Rows[i] {
+				s += fmt.Sprint(v, " ")
+			}
+			got = append(got, fmt.Sprint(s, math.Round(area*1e9)/1e9, " ", parts))
+			if want := geomBounds(rec.Geometry); !reflect.DeepEqual(rec.Bounds, want) {
+				t.Errorf("%s: feature %d bounds %v, want %v", test.opts.Op, i, rec.Bounds, want)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.opts.Op, got, test.want)
+		}
+		if test.opts.Op == OverlayUnion {
+			// multipart pieces and blank attributes
+			writeTestLayer(t, out)
+		}
+	}
+}
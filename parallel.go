@@ -0,0 +1,203 @@
+package shapefile
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ParallelOptions configures DecodeParallel.
+type ParallelOptions struct {
+	// Workers is the number of decoding goroutines. It defaults to
+	// GOMAXPROCS.
+	Workers int
+	// BatchSize is the number of consecutive records a worker decodes
+	// at a time. It defaults to 256.
+	BatchSize int
+	// MaxPending bounds memory use by limiting the number of batches
+	// that have been dispatched but not yet delivered. It defaults to
+	// twice the number of workers.
+	MaxPending int
+	// Unordered delivers batches as soon as they are decoded instead of
+	// in file order.
+	Unordered bool
+	// Orientation sets how the rings of polygons are oriented.
+	Orientation Orientation
+}
+
+type parallelBatch struct {
+	n    int // batch number
+	recs []*ShapefileRecord
+	err  error
+}
+
+// DecodeParallel decodes the records of shp located by index on several
+// goroutines, and calls fn with each of them. fn is always called from
+// the calling goroutine. Decoding stops at the first error returned by
+// a worker or by fn, or when ctx is cancelled, and that error is
+// returned. DecodeParallel does not return before its goroutines have
+// stopped reading shp.
+func DecodeParallel(ctx context.Context, shp io.ReaderAt, index []IndexEntry,
+	opts ParallelOptions, fn func(*ShapefileRecord) error) error {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 2 * opts.Workers
+	}
+	nbatch := (len(index) + opts.BatchSize - 1) / opts.BatchSize
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	jobs := make(chan int)
+	results := make(chan parallelBatch, opts.MaxPending)
+	tokens := make(chan struct{}, opts.MaxPending) // batches in flight
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		for n := 0; n < nbatch; n++ {
+			select {
+			case tokens <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var workers sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		workers.Add(1)
+		go func() {
+			defer wg.Done()
+			defer workers.Done()
+			var buf []byte
+			for n := range jobs {
+				start := n * opts.BatchSize
+				end := min(start+opts.BatchSize, len(index))
+				batch := parallelBatch{n: n}
+				batch.recs, buf, batch.err = decodeBatch(shp, index, start, end, opts.Orientation, buf)
+				select {
+				case results <- batch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]parallelBatch)
+	next := 0
+	deliver := func(batch parallelBatch) error {
+		<-tokens
+		if batch.err != nil {
+			return batch.err
+		}
+		for _, rec := range batch.recs {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for next < nbatch {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var batch parallelBatch
+		var ok bool
+		select {
+		case batch, ok = <-results:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !ok {
+			return ctx.Err()
+		}
+		if opts.Unordered {
+			next++
+			if err := deliver(batch); err != nil {
+				return err
+			}
+			continue
+		}
+		pending[batch.n] = batch
+		for {
+			batch, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if err := deliver(batch); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodeBatch decodes records start to end of index. Records stored
+// back to back are read from shp with a single call. Polygons are
+// oriented following o.
+func decodeBatch(shp io.ReaderAt, index []IndexEntry, start, end int, o Orientation,
+	buf []byte) (recs []*ShapefileRecord, _ []byte, err error) {
+	recs = make([]*ShapefileRecord, 0, end-start)
+	for i := start; i < end; {
+		// extend the run while records are contiguous
+		j := i + 1
+		for j < end && index[j].Offset == index[j-1].Offset+8+int64(index[j-1].Length) {
+			j++
+		}
+		first, last := index[i], index[j-1]
+		n := int(last.Offset - first.Offset + 8 + int64(last.Length))
+		if cap(buf) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if nr, err := shp.ReadAt(buf, first.Offset); nr < n {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, buf, &RecordError{Kind: KindShp, Record: i + 1, Offset: first.Offset, Err: err}
+		}
+		for k := i; k < j; k++ {
+			off := int(index[k].Offset - first.Offset)
+			rec := &ShapefileRecord{header: &shapefileRecordHeader{
+				RecordNumber:  int32(b.Uint32(buf[off:])),
+				ContentLength: int32(b.Uint32(buf[off+4:])),
+			}, offset: index[k].Offset, index: k}
+			if int(rec.header.ContentLength)*2 != index[k].Length {
+				// the index gives the only acceptable length
+				err = &LengthError{Field: "ContentLength", Value: int64(rec.header.ContentLength),
+					Min: int64(index[k].Length / 2), Max: int64(index[k].Length / 2)}
+			} else {
+				err = rec.recordContent(buf[off+8:off+8+index[k].Length], o)
+			}
+			if err != nil {
+				return nil, buf, &RecordError{Kind: KindShp, Record: k + 1, Offset: index[k].Offset, Err: err}
+			}
+			recs = append(recs, rec)
+		}
+		i = j
+	}
+	return recs, buf, nil
+}
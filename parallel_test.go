@@ -0,0 +1,120 @@
+package shapefile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+func TestDecodeParallel(t *testing.T) {
+	shp, shx := new(memFile), new(memFile)
+	w, err := NewShapefileWriter(shp, shx, POINT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 1000
+	for i := 0; i < n; i++ {
+		if err = w.Write(geom.Point{X: float64(i), Y: float64(-i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, index, err := ReadIndex(shx.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(shp.buf)
+
+	var got []float64
+	err = DecodeParallel(context.Background(), r, index,
+		ParallelOptions{Workers: 4, BatchSize: 7},
+		func(rec *ShapefileRecord) error {
+			got = append(got, rec.Geometry.(geom.Point).X)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != n {
+		t.Fatalf("decoded %d records", len(got))
+	}
+	for i, x := range got {
+		if x != float64(i) {
+			t.Fatalf("record %d out of order: %v", i, x)
+		}
+	}
+
+	got = got[:0]
+	err = DecodeParallel(context.Background(), r, index,
+		ParallelOptions{Workers: 4, BatchSize: 7, Unordered: true},
+		func(rec *ShapefileRecord) error {
+			got = append(got, rec.Geometry.(geom.Point).X)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Float64s(got)
+	for i, x := range got {
+		if x != float64(i) {
+			t.Fatalf("record %d missing", i)
+		}
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	err = DecodeParallel(context.Background(), r, index,
+		ParallelOptions{Workers: 4, BatchSize: 7},
+		func(rec *ShapefileRecord) error {
+			if count++; count == 10 {
+				return stop
+			}
+			return nil
+		})
+	if err != stop || count != 10 {
+		t.Errorf("early stop: err %v after %d records", err, count)
+	}
+
+	// no worker may still be reading once DecodeParallel has returned
+	slow := &slowReader{r: r}
+	err = DecodeParallel(context.Background(), slow, index,
+		ParallelOptions{Workers: 4, BatchSize: 1},
+		func(*ShapefileRecord) error { return stop })
+	if err != stop {
+		t.Errorf("early stop: err %v", err)
+	}
+	if n := slow.reading.Load(); n != 0 {
+		t.Errorf("%d reads in progress after return", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = DecodeParallel(ctx, r, index, ParallelOptions{},
+		func(*ShapefileRecord) error { return nil })
+	if err != context.Canceled {
+		t.Errorf("cancelled: err %v", err)
+	}
+}
+
+// slowReader counts the calls to ReadAt in progress, each of which
+// takes a while.
+type slowReader struct {
+	r       io.ReaderAt
+	reading atomic.Int32
+}
+
+func (s *slowReader) ReadAt(p []byte, off int64) (int, error) {
+	s.reading.Add(1)
+	defer s.reading.Add(-1)
+	time.Sleep(time.Millisecond)
+	return s.r.ReadAt(p, off)
+}
@@ -0,0 +1,178 @@
+package shapefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// WriteASCIIGrid writes r in ESRI ASCII grid format. NaN values are
+// written as nodata. Grids with non-square cells use the dx/dy header
+// extension understood by GDAL.
+func (r *Raster) WriteASCIIGrid(w io.Writer, nodata float64) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ncols %d\n", r.Nx)
+	fmt.Fprintf(bw, "nrows %d\n", r.Ny)
+	fmt.Fprintf(bw, "xllcorner %s\n", formatGridValue(r.X0))
+	fmt.Fprintf(bw, "yllcorner %s\n", formatGridValue(r.Y0))
+	if r.Dx == r.Dy {
+		fmt.Fprintf(bw, "cellsize %s\n", formatGridValue(r.Dx))
+	} else {
+		fmt.Fprintf(bw, "dx %s\n", formatGridValue(r.Dx))
+		fmt.Fprintf(bw, "dy %s\n", formatGridValue(r.Dy))
+	}
+	fmt.Fprintf(bw, "NODATA_value %s\n", formatGridValue(nodata))
+	// rows are written from the top of the grid down
+	for j := r.Ny - 1; j >= 0; j-- {
+		for i, v := range r.Data[j] {
+			if i > 0 {
+				bw.WriteByte(' ')
+			}
+			if math.IsNaN(v) {
+				v = nodata
+			}
+			bw.WriteString(formatGridValue(v))
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func formatGridValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// TIFF tags used by WriteGeoTIFF.
+const (
+	tiffImageWidth       = 256
+	tiffImageLength      = 257
+	tiffBitsPerSample    = 258
+	tiffCompression      = 259
+	tiffPhotometric      = 262
+	tiffStripOffsets     = 273
+	tiffSamplesPerPixel  = 277
+	tiffRowsPerStrip     = 278
+	tiffStripByteCounts  = 279
+	tiffPlanarConfig     = 284
+	tiffSampleFormat     = 339
+	tiffModelPixelScale  = 33550
+	tiffModelTiepoint    = 33922
+	tiffGeoKeyDirectory  = 34735
+	tiffGDALNoData       = 42113
+	tiffTypeShort        = 3
+	tiffTypeLong         = 4
+	tiffTypeDouble       = 12
+	tiffTypeASCII        = 2
+	tiffSampleFormatIEEE = 3
+)
+
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte // value bytes, stored inline if 4 bytes or fewer
+}
+
+// WriteGeoTIFF writes r as an uncompressed, single band float64
+// GeoTIFF. The georeferencing is written without a coordinate reference
+// system, which callers can assign in their GIS. Classic TIFF offsets
+// are 32 bits, so rasters whose file would reach 4 GiB are refused.
+func (r *Raster) WriteGeoTIFF(w io.Writer, nodata float64) error {
+	size := 8 * int64(r.Nx) * int64(r.Ny)
+	tooLarge := fmt.Errorf("%d by %d raster is too large for a TIFF file", r.Nx, r.Ny)
+	if size > math.MaxUint32 {
+		return tooLarge
+	}
+	short := func(v ...uint16) []byte {
+		var buf []byte
+		for _, x := range v {
+			buf = l.AppendUint16(buf, x)
+		}
+		return buf
+	}
+	long := func(v uint32) []byte { return l.AppendUint32(nil, v) }
+	double := func(v ...float64) []byte {
+		var buf []byte
+		for _, x := range v {
+			buf = appendFloat64(buf, x)
+		}
+		return buf
+	}
+	nodataText := formatGridValue(nodata) + "\x00"
+	imageSize := uint32(size)
+
+	entries := []tiffEntry{
+		{tiffImageWidth, tiffTypeLong, 1, long(uint32(r.Nx))},
+		{tiffImageLength, tiffTypeLong, 1, long(uint32(r.Ny))},
+		{tiffBitsPerSample, tiffTypeShort, 1, short(64)},
+		{tiffCompression, tiffTypeShort, 1, short(1)},
+		{tiffPhotometric, tiffTypeShort, 1, short(1)},
+		{tiffStripOffsets, tiffTypeLong, 1, nil}, // filled in below
+		{tiffSamplesPerPixel, tiffTypeShort, 1, short(1)},
+		{tiffRowsPerStrip, tiffTypeLong, 1, long(uint32(r.Ny))},
+		{tiffStripByteCounts, tiffTypeLong, 1, long(imageSize)},
+		{tiffPlanarConfig, tiffTypeShort, 1, short(1)},
+		{tiffSampleFormat, tiffTypeShort, 1, short(tiffSampleFormatIEEE)},
+		{tiffModelPixelScale, tiffTypeDouble, 3, double(r.Dx, r.Dy, 0)},
+		{tiffModelTiepoint, tiffTypeDouble, 6,
+			double(0, 0, 0, r.X0, r.Y0+float64(r.Ny)*r.Dy, 0)},
+		// version 1.1.0 with one key: GTRasterTypeGeoKey = PixelIsArea
+		{tiffGeoKeyDirectory, tiffTypeShort, 8, short(1, 1, 0, 1, 1025, 0, 1, 1)},
+		{tiffGDALNoData, tiffTypeASCII, uint32(len(nodataText)), []byte(nodataText)},
+	}
+
+	// layout: header, IFD, out-of-line values, image data
+	const headerSize = 8
+	ifdSize := 2 + 12*len(entries) + 4
+	extra := uint32(headerSize + ifdSize)
+	var outOfLine []byte
+	offsets := make([]uint32, len(entries))
+	for i, e := range entries {
+		if len(e.data) > 4 {
+			offsets[i] = extra + uint32(len(outOfLine))
+			outOfLine = append(outOfLine, e.data...)
+			if len(outOfLine)%2 == 1 {
+				outOfLine = append(outOfLine, 0)
+			}
+		}
+	}
+	imageOffset := extra + uint32(len(outOfLine))
+	if int64(imageOffset)+size > math.MaxUint32 {
+		return tooLarge
+	}
+	entries[5].data = long(imageOffset)
+
+	bw := bufio.NewWriter(w)
+	buf := []byte{'I', 'I', 42, 0}
+	buf = l.AppendUint32(buf, headerSize)
+	buf = l.AppendUint16(buf, uint16(len(entries)))
+	for i, e := range entries {
+		buf = l.AppendUint16(buf, e.tag)
+		buf = l.AppendUint16(buf, e.typ)
+		buf = l.AppendUint32(buf, e.count)
+		if len(e.data) > 4 {
+			buf = l.AppendUint32(buf, offsets[i])
+		} else {
+			value := make([]byte, 4)
+			copy(value, e.data)
+			buf = append(buf, value...)
+		}
+	}
+	buf = l.AppendUint32(buf, 0) // no further IFDs
+	buf = append(buf, outOfLine...)
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	// rows are written from the top of the grid down
+	for j := r.Ny - 1; j >= 0; j-- {
+		buf = buf[:0]
+		for _, v := range r.Data[j] {
+			buf = appendFloat64(buf, v)
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,269 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// Grid is a regular grid of Nx by Ny cells of size Dx by Dy whose lower
+// left corner is at (X0, Y0).
+type Grid struct {
+	X0, Y0 float64
+	Dx, Dy float64
+	Nx, Ny int
+}
+
+// cell returns the bounds of cell (i, j), counting from the lower left.
+func (g *Grid) cell(i, j int) *geom.Bounds {
+	x, y := g.X0+float64(i)*g.Dx, g.Y0+float64(j)*g.Dy
+	return &geom.Bounds{
+		Min: geom.Point{X: x, Y: y},
+		Max: geom.Point{X: x + g.Dx, Y: y + g.Dy},
+	}
+}
+
+// cellRange returns the range of cells overlapping b, and false if
+// there are none.
+func (g *Grid) cellRange(b *geom.Bounds) (i0, j0, i1, j1 int, ok bool) {
+	i0 = int(math.Floor((b.Min.X - g.X0) / g.Dx))
+	j0 = int(math.Floor((b.Min.Y - g.Y0) / g.Dy))
+	i1 = int(math.Floor((b.Max.X - g.X0) / g.Dx))
+	j1 = int(math.Floor((b.Max.Y - g.Y0) / g.Dy))
+	if i1 < 0 || j1 < 0 || i0 >= g.Nx || j0 >= g.Ny {
+		return 0, 0, 0, 0, false
+	}
+	return max(i0, 0), max(j0, 0), min(i1, g.Nx-1), min(j1, g.Ny-1), true
+}
+
+// Raster holds one value per grid cell. Data[j][i] is the value of
+// column i of row j, with row 0 at the bottom of the grid.
+type Raster struct {
+	Grid
+	Data [][]float64
+}
+
+// NewRaster returns a raster of zeros covering g.
+func NewRaster(g Grid) *Raster {
+	r := &Raster{Grid: g, Data: make([][]float64, g.Ny)}
+	for j := range r.Data {
+		r.Data[j] = make([]float64, g.Nx)
+	}
+	return r
+}
+
+// RasterizeOptions configures Rasterize.
+type RasterizeOptions struct {
+	// AreaFraction burns the fraction of each cell covered by a polygon,
+	// rather than burning whole cells whose centres lie inside it.
+	AreaFraction bool
+	// LineLength burns the length of line within each cell, rather than
+	// burning whole cells that the line passes through.
+	LineLength bool
+	// Field names a numeric field whose value is multiplied into
+	// everything a feature burns. If empty, every feature has value 1.
+	Field string
+}
+
+// Rasterize burns the features of layer onto grid. Points burn their
+// value into the cell containing them. Contributions of overlapping
+// features are summed.
+func Rasterize(layer *Layer, grid Grid, opts RasterizeOptions) (r *Raster, err error) {
+	if grid.Dx <= 0 || grid.Dy <= 0 || grid.Nx <= 0 || grid.Ny <= 0 {
+		return nil, fmt.Errorf("invalid grid: %+v", grid)
+	}
+	col := -1
+	if opts.Field != "" {
+		if col = layer.FieldIndex(opts.Field); col < 0 {
+			return nil, fmt.Errorf("layer has no field %s", opts.Field)
+		}
+	}
+	r = NewRaster(grid)
+	for i, rec := range layer.Records {
+		g := rec.Geometry
+		if g == nil {
+			continue
+		}
+		value := 1.
+		if col >= 0 {
+			var ok bool
+			if layer.Rows[i] == nil {
+				continue
+			}
+			if value, ok = toFloat(layer.Rows[i][col]); !ok {
+				continue
+			}
+		}
+		switch {
+		case isPolygonal(g):
+			r.burnPolygon(geomParts(g), value, opts.AreaFraction)
+		case isPuntal(g):
+			eachPoint(g, func(p geom.Point) {
+				r.burnPoint(p, value)
+			})
+		default:
+			r.burnLines(geomParts(g), value, opts.LineLength)
+		}
+	}
+	return r, nil
+}
+
+func (r *Raster) burnPoint(p geom.Point, value float64) {
+	i := int(math.Floor((p.X - r.X0) / r.Dx))
+	j := int(math.Floor((p.Y - r.Y0) / r.Dy))
+	if i >= 0 && j >= 0 && i < r.Nx && j < r.Ny {
+		r.Data[j][i] += value
+	}
+}
+
+func (r *Raster) burnPolygon(rings [][]geom.Point, value float64, fraction bool) {
+	b := geomBounds(geom.Polygon{Rings: rings})
+	if b == nil {
+		return
+	}
+	i0, j0, i1, j1, ok := r.cellRange(b)
+	if !ok {
+		return
+	}
+	// Sign of each ring's contribution to the clipped area, so that
+	// holes subtract whichever way the rings wind.
+	signs := make([]float64, len(rings))
+	for k, ring := range rings {
+		signs[k] = 1
+		if (signedArea(ring) < 0) != ringIsHole(rings, k) {
+			signs[k] = -1
+		}
+	}
+	cellArea := r.Dx * r.Dy
+	for j := j0; j <= j1; j++ {
+		for i := i0; i <= i1; i++ {
+			cell := r.cell(i, j)
+			if !fraction {
+				center := geom.Point{
+					X: (cell.Min.X + cell.Max.X) / 2,
+					Y: (cell.Min.Y + cell.Max.Y) / 2,
+				}
+				if pointInRings(center, rings) {
+					r.Data[j][i] += value
+				}
+				continue
+			}
+			area := 0.
+			for k, ring := range rings {
+				area += signs[k] * signedArea(clipRing(ring, cell))
+			}
+			if area > 0 {
+				r.Data[j][i] += value * math.Min(1, area/cellArea)
+			}
+		}
+	}
+}
+
+func (r *Raster) burnLines(parts [][]geom.Point, value float64, length bool) {
+	touched := make(map[[2]int]bool)
+	for _, part := range parts {
+		for k := 1; k < len(part); k++ {
+			a, b := part[k-1], part[k]
+			sb := &geom.Bounds{
+				Min: geom.Point{X: math.Min(a.X, b.X), Y: math.Min(a.Y, b.Y)},
+				Max: geom.Point{X: math.Max(a.X, b.X), Y: math.Max(a.Y, b.Y)},
+			}
+			i0, j0, i1, j1, ok := r.cellRange(sb)
+			if !ok {
+				continue
+			}
+			for j := j0; j <= j1; j++ {
+				for i := i0; i <= i1; i++ {
+					t0, t1, ok := clipSegment(a, b, r.cell(i, j))
+					if !ok || (t0 == t1 && a != b) {
+						// grazing a cell corner does not count
+						continue
+					}
+					if length {
+						r.Data[j][i] += value * (t1 - t0) *
+							math.Hypot(b.X-a.X, b.Y-a.Y)
+					} else if !touched[[2]int{i, j}] {
+						touched[[2]int{i, j}] = true
+						r.Data[j][i] += value
+					}
+				}
+			}
+		}
+	}
+}
+
+// clipSegment clips segment ab to the box c (Liang-Barsky), returning
+// the parameter range of ab that lies inside it.
+func clipSegment(a, b geom.Point, c *geom.Bounds) (t0, t1 float64, ok bool) {
+	t0, t1 = 0, 1
+	dx, dy := b.X-a.X, b.Y-a.Y
+	for _, e := range [4][2]float64{
+		{-dx, a.X - c.Min.X}, {dx, c.Max.X - a.X},
+		{-dy, a.Y - c.Min.Y}, {dy, c.Max.Y - a.Y},
+	} {
+		p, q := e[0], e[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 {
+			t0 = math.Max(t0, t)
+		} else {
+			t1 = math.Min(t1, t)
+		}
+		if t0 > t1 {
+			return 0, 0, false
+		}
+	}
+	return t0, t1, true
+}
+
+// clipRing clips a ring to the box c (Sutherland-Hodgman). The result
+// keeps the orientation of the input.
+func clipRing(ring []geom.Point, c *geom.Bounds) []geom.Point {
+	type edge struct {
+		inside func(p geom.Point) bool
+		cut    func(p, q geom.Point) geom.Point
+	}
+	atX := func(x float64) func(p, q geom.Point) geom.Point {
+		return func(p, q geom.Point) geom.Point {
+			return geom.Point{X: x, Y: p.Y + (q.Y-p.Y)*(x-p.X)/(q.X-p.X)}
+		}
+	}
+	atY := func(y float64) func(p, q geom.Point) geom.Point {
+		return func(p, q geom.Point) geom.Point {
+			return geom.Point{X: p.X + (q.X-p.X)*(y-p.Y)/(q.Y-p.Y), Y: y}
+		}
+	}
+	edges := []edge{
+		{func(p geom.Point) bool { return p.X >= c.Min.X }, atX(c.Min.X)},
+		{func(p geom.Point) bool { return p.X <= c.Max.X }, atX(c.Max.X)},
+		{func(p geom.Point) bool { return p.Y >= c.Min.Y }, atY(c.Min.Y)},
+		{func(p geom.Point) bool { return p.Y <= c.Max.Y }, atY(c.Max.Y)},
+	}
+	out := ring
+	for _, e := range edges {
+		if len(out) == 0 {
+			break
+		}
+		in := out
+		out = nil
+		prev := in[len(in)-1]
+		for _, p := range in {
+			switch {
+			case e.inside(p) && !e.inside(prev):
+				out = append(out, e.cut(prev, p), p)
+			case e.inside(p):
+				out = append(out, p)
+			case e.inside(prev):
+				out = append(out, e.cut(prev, p))
+			}
+			prev = p
+		}
+	}
+	return out
+}
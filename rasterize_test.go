@@ -0,0 +1,89 @@
+package shapefile
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+func TestRasterize(t *testing.T) {
+	grid := Grid{Dx: 1, Dy: 1, Nx: 2, Ny: 2}
+	layer := &Layer{
+		Type:   POLYGON,
+		Fields: []FieldDescriptor{NewFieldDescriptor("V", Number, 4, 0)},
+	}
+	layer.add(&ShapefileRecord{Geometry: square(0, 0, 1.5)}, []interface{}{2})
+
+	r, err := Rasterize(layer, grid, RasterizeOptions{AreaFraction: true, Field: "V"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float64{{2, 1}, {1, 0.5}}
+	for j := range want {
+		for i := range want[j] {
+			if math.Abs(r.Data[j][i]-want[j][i]) > 1e-12 {
+				t.Errorf("cell (%d, %d) = %v, want %v", i, j, r.Data[j][i], want[j][i])
+			}
+		}
+	}
+
+	r, err = Rasterize(layer, grid, RasterizeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Data[0][0] != 1 || r.Data[1][1] != 0 {
+		t.Errorf("unexpected cell centre burn: %v", r.Data)
+	}
+
+	var buf bytes.Buffer
+	if err = r.WriteASCIIGrid(&buf, -9999); err != nil {
+		t.Fatal(err)
+	}
+	wantText := `ncols 2
+nrows 2
+xllcorner 0
+yllcorner 0
+cellsize 1
+NODATA_value -9999
+0 0
+1 0
+`
+	if buf.String() != wantText {
+		t.Errorf("unexpected ASCII grid:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err = r.WriteGeoTIFF(&buf, -9999); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("II*\x00")) {
+		t.Errorf("missing TIFF header")
+	}
+
+	// 4 GiB of pixels, refused before any of them are read
+	huge := &Raster{Grid: Grid{Dx: 1, Dy: 1, Nx: 1 << 16, Ny: 1 << 13}}
+	if err = huge.WriteGeoTIFF(io.Discard, -9999); err == nil {
+		t.Errorf("no error for a raster too large for TIFF")
+	}
+}
+
+func TestRasterizeLineLength(t *testing.T) {
+	grid := Grid{X0: -1, Dx: 1, Dy: 1, Nx: 4, Ny: 1}
+	layer := &Layer{Type: POLY_LINE}
+	layer.add(&ShapefileRecord{Geometry: geom.LineString{
+		Points: []geom.Point{{X: -0.5, Y: 0.5}, {X: 1.5, Y: 0.5}},
+	}}, nil)
+	r, err := Rasterize(layer, grid, RasterizeOptions{LineLength: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{0.5, 1, 0.5, 0}
+	for i, v := range want {
+		if math.Abs(r.Data[0][i]-v) > 1e-12 {
+			t.Errorf("cell %d = %v, want %v", i, r.Data[0][i], v)
+		}
+	}
+}
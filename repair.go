@@ -0,0 +1,302 @@
+package shapefile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// RepairReport describes the changes made by Repair.
+type RepairReport struct {
+	Records       int   // records in the repaired .shp file
+	Dropped       []int // numbers of the records replaced with null shapes
+	Skipped       int64 // bytes of broken records removed from the .shp file
+	Truncated     int64 // trailing bytes removed from the .shp file
+	HeaderChanged bool  // whether the .shp header was rewritten
+	DBFRows       int   // rows in the .dbf file, or -1 without one
+	DBFChanged    bool  // whether NumRecords of the .dbf file was corrected
+}
+
+// RepairFiles repairs basename.shp in place, writes a new basename.shx,
+// and corrects basename.dbf if it exists. See Repair.
+func RepairFiles(basename string) (r *RepairReport, err error) {
+	shp, err := os.OpenFile(basename+".shp", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer shp.Close()
+	dbf, err := os.OpenFile(basename+".dbf", os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		dbf = nil
+	} else if err != nil {
+		return nil, err
+	} else {
+		defer dbf.Close()
+	}
+	// the old index is only replaced once the repair has succeeded
+	shx, err := os.Create(basename + ".shx.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if cerr := shx.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(shx.Name(), basename+".shx")
+		} else {
+			os.Remove(shx.Name())
+		}
+	}()
+	return Repair(shp, shx, dbf)
+}
+
+// Repair scans the records of shp and removes those that are not well
+// formed: records whose content does not fit in the file, or does not
+// match their shape type, or whose shape type is neither that of the
+// file nor the null shape. After a broken record, the file is searched
+// for the next well formed one, as in lenient reading without an index.
+// The records in between are replaced with null shapes, so that the
+// rows of the .dbf file still line up, and reported in Dropped. If no
+// record follows, the file is truncated after the last one kept. The
+// header is rewritten with the file code, version, length and XY, Z and
+// M extents that match the records, and an index of the records is
+// written to shx.
+//
+// dbf may be nil. Otherwise its NumRecords is set to the number of rows
+// the file holds. Rows are not added or removed to match the shapefile.
+func Repair(shp *os.File, shx io.Writer, dbf *os.File) (*RepairReport, error) {
+	r := &RepairReport{DBFRows: -1}
+	fi, err := shp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	src := &readerAtSource{r: shp, n: fi.Size()}
+	size := src.size()
+	old, err := src.at(0, 100)
+	if err != nil {
+		return nil, &HeaderError{Kind: KindShp, Err: err}
+	}
+	h := &ShapefileHeader{Version: 1000, ShapeType: ShapeType(l.Uint32(old[32:]))}
+	if h.ShapeType.String() == "UNKNOWN" {
+		return nil, &HeaderError{Kind: KindShp, Field: "ShapeType", Offset: 32,
+			Err: fmt.Errorf("unknown shape type: %d", h.ShapeType)}
+	}
+
+	var env envelope
+	// check returns the number and content length of the record at off,
+	// and whether it is well formed.
+	check := func(off int64) (num int32, n int64, ok bool, err error) {
+		buf, err := src.at(off, 8)
+		if err != nil {
+			return
+		}
+		num, n = int32(b.Uint32(buf[0:])), 2*int64(b.Uint32(buf[4:]))
+		if n < 4 || off+8+n > size {
+			return num, n, false, nil
+		}
+		content, err := src.at(off+8, int(n))
+		if err != nil {
+			return
+		}
+		return num, n, env.add(h.ShapeType, content), nil
+	}
+
+	var index []IndexEntry // in the repaired file
+	var from []int64       // offset of each record in shp, or -1 for a null shape
+	var nums []int32
+	var last int32 // number of the last record kept
+	off, out := int64(100), int64(100)
+	for off+8 <= size {
+		num, n, ok, err := check(off)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// look for the next record after the header of the broken one
+			next := int64(-1)
+			var chunk []byte
+			var base int64
+			for p := off + 8; p+12 <= size && next < 0; p++ {
+				if p+12 > base+int64(len(chunk)) {
+					base = p
+					if chunk, err = src.at(p, int(min(64<<10, size-p))); err != nil {
+						return nil, err
+					}
+				}
+				if !plausibleHeader(chunk[p-base:], h.ShapeType, last, p-off, size-p) {
+					continue
+				}
+				if num, n, ok, err = check(p); err != nil {
+					return nil, err
+				} else if ok {
+					next = p
+				}
+			}
+			if next < 0 {
+				break
+			}
+			// plausibleHeader leaves room for 12 bytes per null shape
+			for k := last + 1; k < num; k++ {
+				r.Dropped = append(r.Dropped, int(k))
+				index = append(index, IndexEntry{Offset: out, Length: 4})
+				from, nums = append(from, -1), append(nums, k)
+				out += 12
+			}
+			r.Skipped += next - off
+			off = next
+		}
+		index = append(index, IndexEntry{Offset: out, Length: int(n)})
+		from, nums = append(from, off), append(nums, num)
+		last = num
+		off += 8 + n
+		out += 8 + n
+	}
+	r.Records = len(index)
+	r.Truncated = size - off
+	h.FileLength = int32(out / 2)
+	env.setHeader(h)
+
+	// move the records after the first broken one into place; they are
+	// read before they are overwritten
+	for i, e := range index {
+		if from[i] == e.Offset {
+			continue
+		}
+		var rec []byte
+		if from[i] < 0 {
+			rec = b.AppendUint32(b.AppendUint32(nil, uint32(nums[i])), 2)
+			rec = l.AppendUint32(rec, uint32(NULL_SHAPE))
+		} else if rec, err = src.at(from[i], 8+e.Length); err != nil {
+			return nil, err
+		}
+		if _, err = shp.WriteAt(rec, e.Offset); err != nil {
+			return nil, err
+		}
+	}
+
+	var hdr bytes.Buffer
+	if err = writeShapefileHeader(&hdr, h); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hdr.Bytes(), old) {
+		r.HeaderChanged = true
+		if _, err = shp.WriteAt(hdr.Bytes(), 0); err != nil {
+			return nil, err
+		}
+	}
+	if out < size {
+		if err = shp.Truncate(out); err != nil {
+			return nil, err
+		}
+	}
+
+	w := bufio.NewWriter(shx)
+	shxHeader := *h
+	shxHeader.FileLength = 50 + 4*int32(len(index))
+	if err = writeShapefileHeader(w, &shxHeader); err != nil {
+		return nil, err
+	}
+	for _, e := range index {
+		buf := b.AppendUint32(nil, uint32(e.Offset/2))
+		if _, err = w.Write(b.AppendUint32(buf, uint32(e.Length/2))); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if dbf != nil {
+		if r.DBFRows, r.DBFChanged, err = repairDBF(dbf); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// repairDBF sets NumRecords in the header of dbf to the number of rows
+// that follow the header.
+func repairDBF(dbf *os.File) (rows int, changed bool, err error) {
+	fi, err := dbf.Stat()
+	if err != nil {
+		return
+	}
+	buf := make([]byte, 32)
+	if _, err = dbf.ReadAt(buf, 0); err != nil {
+		return 0, false, &HeaderError{Kind: KindDbf, Err: err}
+	}
+	lenHeader, lenRecord := int64(l.Uint16(buf[8:])), int64(l.Uint16(buf[10:]))
+	if lenRecord == 0 {
+		return 0, false, &HeaderError{Kind: KindDbf, Field: "LenRecord", Offset: 10,
+			Err: &LengthError{Field: "LenRecord", Min: 1, Max: math.MaxUint16}}
+	}
+	// a trailing end of file marker is not a whole row and is dropped
+	rows = int(max(fi.Size()-lenHeader, 0) / lenRecord)
+	if int(l.Uint32(buf[4:])) == rows {
+		return rows, false, nil
+	}
+	_, err = dbf.WriteAt(l.AppendUint32(nil, uint32(rows)), 4)
+	return rows, true, err
+}
+
+// envelope accumulates the extents of records.
+type envelope struct {
+	xmin, ymin, xmax, ymax float64
+	z, m                   [2]float64 // minimum and maximum
+	hasXY, hasZ, hasM      bool
+}
+
+// add adds a record of a file of type t to the envelope. It returns false,
+// without changing the envelope, if the record is not well formed.
+func (e *envelope) add(t ShapeType, content []byte) bool {
+	v := RecordView{Content: content}
+	rt := v.Type()
+	if rt != t && rt != NULL_SHAPE {
+		return false
+	}
+	lo, ok := recordLayout(rt, content)
+	if !ok {
+		return false
+	}
+	valid := false
+	for _, n := range lo.lengths {
+		valid = valid || n == len(content)
+	}
+	if !valid {
+		return false
+	}
+	if bounds, ok := v.Bounds(); ok {
+		if !e.hasXY {
+			e.xmin, e.ymin = bounds.Min.X, bounds.Min.Y
+			e.xmax, e.ymax = bounds.Max.X, bounds.Max.Y
+			e.hasXY = true
+		}
+		e.xmin, e.ymin = math.Min(e.xmin, bounds.Min.X), math.Min(e.ymin, bounds.Min.Y)
+		e.xmax, e.ymax = math.Max(e.xmax, bounds.Max.X), math.Max(e.ymax, bounds.Max.Y)
+	}
+	if min, max, ok := lo.zrange(content); ok {
+		e.z, e.hasZ = extend(e.z, e.hasZ, min, max), true
+	}
+	if min, max, ok := lo.mrange(content); ok && min > noData {
+		e.m, e.hasM = extend(e.m, e.hasM, min, max), true
+	}
+	return true
+}
+
+func extend(r [2]float64, has bool, min, max float64) [2]float64 {
+	if !has {
+		return [2]float64{min, max}
+	}
+	return [2]float64{math.Min(r[0], min), math.Max(r[1], max)}
+}
+
+// setHeader sets the extents in h. Extents without values are zero.
+func (e *envelope) setHeader(h *ShapefileHeader) {
+	h.Xmin, h.Ymin, h.Xmax, h.Ymax = e.xmin, e.ymin, e.xmax, e.ymax
+	h.Zmin, h.Zmax = e.z[0], e.z[1]
+	h.Mmin, h.Mmax = e.m[0], e.m[1]
+}
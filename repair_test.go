@@ -0,0 +1,114 @@
+package shapefile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRepairFiles(t *testing.T) {
+	layer := &Layer{
+		Type:   POLYGON,
+		Fields: []FieldDescriptor{NewFieldDescriptor("ID", Number, 4, 0)},
+	}
+	for i := 0; i < 5; i++ {
+		layer.add(&ShapefileRecord{Geometry: square(float64(i), 0, 1)}, []interface{}{i})
+	}
+	shp, shx, dbf := new(memFile), new(memFile), new(memFile)
+	if err := layer.Write(shp, shx, dbf); err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte(nil), shx.buf...)
+
+	// break the header and the dbf record count, and add garbage
+	data := append(append([]byte(nil), shp.buf...), 1, 2, 3, 4, 5, 6, 7, 8, 9)
+	b.PutUint32(data[24:], 10)
+	l.PutUint64(data[52:], 0)
+	l.PutUint32(dbf.buf[4:], 2)
+	basename := filepath.Join(t.TempDir(), "broken")
+	for ext, data := range map[string][]byte{".shp": data, ".dbf": dbf.buf} {
+		if err := os.WriteFile(basename+ext, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := RepairFiles(basename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Records != 5 || r.Truncated != 9 || !r.HeaderChanged || r.DBFRows != 5 || !r.DBFChanged {
+		t.Errorf("report %+v", r)
+	}
+	problems, err := ValidateFiles(basename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("problems after repair: %v", problems)
+	}
+	got, err := os.ReadFile(basename + ".shx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("rebuilt index differs from the original")
+	}
+	if got, _ := os.ReadFile(basename + ".shp"); string(got) != string(shp.buf) {
+		t.Errorf("repaired file differs from the original")
+	}
+}
+
+func TestRepairBrokenRecords(t *testing.T) {
+	data, index := brokenFile(t, 6)
+	// record 3 cannot be decoded and record 5 is too long; record 4
+	// claims the content of record 5 as well
+	b.PutUint32(data[index[3].Offset+4:], uint32(index[5].Offset-index[3].Offset-8)/2)
+	basename := filepath.Join(t.TempDir(), "broken")
+	if err := os.WriteFile(basename+".shp", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := RepairFiles(basename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := index[5].Offset - index[2].Offset
+	if r.Records != 6 || r.Truncated != 0 || r.Skipped != skipped ||
+		!reflect.DeepEqual(r.Dropped, []int{3, 4, 5}) {
+		t.Errorf("report %+v", r)
+	}
+	problems, err := ValidateFiles(basename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("problems after repair: %v", problems)
+	}
+	f, err := os.Open(basename + ".shp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, err := OpenShapefile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		rec, err := s.NextRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprint(rec.Number(), rec.Type))
+	}
+	want := []string{"1 POLYGON", "2 POLYGON", "3 NULL_SHAPE", "4 NULL_SHAPE",
+		"5 NULL_SHAPE", "6 POLYGON"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
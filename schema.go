@@ -0,0 +1,228 @@
+package shapefile
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// nullableFlag is the bit of FieldDescriptor.FlagSetField that Visual
+// FoxPro sets for fields that may hold null values.
+const nullableFlag = 0x02
+
+// Column describes a field of a .dbf file.
+type Column struct {
+	Name      string
+	FieldType FieldType
+	// GoType is the type of the values NextRecord returns for the field,
+	// or nil if they are not decoded.
+	GoType    reflect.Type
+	Width     int // in bytes
+	Precision int // decimal places of numeric fields
+	// Nullable is set for fields that Visual FoxPro marks as nullable.
+	// Null values, kept in the hidden _NullFlags field, are not decoded.
+	Nullable bool
+}
+
+// NewColumn returns the column of a field descriptor.
+func NewColumn(fd FieldDescriptor) Column {
+	c := Column{
+		Name:      fd.fieldName(),
+		FieldType: fd.FieldType,
+		Width:     fd.Width(),
+		Nullable:  fd.FlagSetField&nullableFlag != 0,
+	}
+	if fd.FieldType != Character {
+		c.Precision = int(fd.DecimalCount)
+	}
+	c.GoType = goType(c.FieldType, c.Precision)
+	return c
+}
+
+// goType returns the type parseField decodes fields of type t to.
+func goType(t FieldType, precision int) reflect.Type {
+	switch t {
+	case Character, VarCharVar:
+		return reflect.TypeOf("")
+	case Number, Integer:
+		if precision == 0 {
+			return reflect.TypeOf(0)
+		}
+		return reflect.TypeOf(0.)
+	case Float, Double:
+		return reflect.TypeOf(0.)
+	case Logical:
+		return reflect.TypeOf(false)
+	case Date:
+		return reflect.TypeOf(time.Time{})
+	}
+	return nil
+}
+
+// Field returns the descriptor of a field for c, for NewDBFWriter.
+// NewDBFWriter writes dBASE III files, which have no null values, so
+// Nullable is not kept.
+func (c Column) Field() FieldDescriptor {
+	return NewFieldDescriptor(c.Name, c.FieldType, c.Width, c.Precision)
+}
+
+func (c Column) String() string {
+	s := fmt.Sprintf("%s %c(%d", c.Name, c.FieldType, c.Width)
+	if c.Precision != 0 {
+		s += fmt.Sprintf(",%d", c.Precision)
+	}
+	s += ")"
+	if c.GoType != nil {
+		s += " " + c.GoType.String()
+	}
+	if c.Nullable {
+		s += " null"
+	}
+	return s
+}
+
+// jsonColumn is the JSON form of a Column.
+type jsonColumn struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	GoType    string `json:"go_type,omitempty"`
+	Width     int    `json:"width"`
+	Precision int    `json:"precision"`
+	Nullable  bool   `json:"nullable"`
+}
+
+func (c Column) MarshalJSON() ([]byte, error) {
+	jc := jsonColumn{Name: c.Name, Type: string(rune(c.FieldType)), Width: c.Width,
+		Precision: c.Precision, Nullable: c.Nullable}
+	if c.GoType != nil {
+		jc.GoType = c.GoType.String()
+	}
+	return json.Marshal(jc)
+}
+
+// UnmarshalJSON reads a column written by MarshalJSON. The Go type is
+// derived from the field type and precision.
+func (c *Column) UnmarshalJSON(data []byte) error {
+	var jc jsonColumn
+	if err := json.Unmarshal(data, &jc); err != nil {
+		return err
+	}
+	if len(jc.Type) != 1 {
+		return fmt.Errorf("column %s: invalid field type %q", jc.Name, jc.Type)
+	}
+	*c = Column{Name: jc.Name, FieldType: FieldType(jc.Type[0]), Width: jc.Width,
+		Precision: jc.Precision, Nullable: jc.Nullable}
+	c.GoType = goType(c.FieldType, c.Precision)
+	return nil
+}
+
+// Schema is the list of columns of a .dbf file, in file order.
+type Schema []Column
+
+// NewSchema returns the schema of the given fields.
+func NewSchema(fields []FieldDescriptor) Schema {
+	s := make(Schema, len(fields))
+	for i, fd := range fields {
+		s[i] = NewColumn(fd)
+	}
+	return s
+}
+
+// Index returns the position of the named column, or -1.
+func (s Schema) Index(name string) int {
+	for i, c := range s {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Fields returns the field descriptors of the schema, for NewDBFWriter.
+func (s Schema) Fields() []FieldDescriptor {
+	fields := make([]FieldDescriptor, len(s))
+	for i, c := range s {
+		fields[i] = c.Field()
+	}
+	return fields
+}
+
+// String lists the columns, one per line.
+func (s Schema) String() string {
+	var sb strings.Builder
+	for _, c := range s {
+		sb.WriteString(c.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// SchemaChangeKind identifies how a column differs between two schemas.
+type SchemaChangeKind int
+
+const (
+	ColumnAdded   SchemaChangeKind = iota // only in the new schema
+	ColumnRemoved                         // only in the old schema
+	ColumnRetyped                         // in both, with different types or sizes
+)
+
+func (k SchemaChangeKind) String() string {
+	switch k {
+	case ColumnAdded:
+		return "added"
+	case ColumnRemoved:
+		return "removed"
+	case ColumnRetyped:
+		return "retyped"
+	default:
+		return "unknown"
+	}
+}
+
+// SchemaChange is a difference between two schemas. Old is nil for added
+// columns and New for removed ones.
+type SchemaChange struct {
+	Kind     SchemaChangeKind
+	Name     string
+	Old, New *Column
+}
+
+func (c SchemaChange) String() string {
+	switch c.Kind {
+	case ColumnAdded:
+		return "+ " + c.New.String()
+	case ColumnRemoved:
+		return "- " + c.Old.String()
+	}
+	return fmt.Sprintf("~ %v -> %v", c.Old, c.New)
+}
+
+// Diff returns the columns of s that to has removed or retyped, in the
+// order of s, then the columns to has added, in the order of to.
+// Columns are matched by name, so a renamed column is removed and added.
+func (s Schema) Diff(to Schema) (changes []SchemaChange) {
+	for i := range s {
+		old := &s[i]
+		j := to.Index(old.Name)
+		switch {
+		case j < 0:
+			changes = append(changes, SchemaChange{Kind: ColumnRemoved, Name: old.Name, Old: old})
+		case !old.same(to[j]):
+			changes = append(changes, SchemaChange{Kind: ColumnRetyped, Name: old.Name,
+				Old: old, New: &to[j]})
+		}
+	}
+	for j := range to {
+		if s.Index(to[j].Name) < 0 {
+			changes = append(changes, SchemaChange{Kind: ColumnAdded, Name: to[j].Name, New: &to[j]})
+		}
+	}
+	return changes
+}
+
+func (c Column) same(o Column) bool {
+	return c.FieldType == o.FieldType && c.Width == o.Width &&
+		c.Precision == o.Precision && c.Nullable == o.Nullable
+}
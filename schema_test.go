@@ -0,0 +1,83 @@
+package shapefile
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	f, err := os.Open(dbf_test_fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dbf, err := OpenDBFFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := dbf.Schema
+	if len(s) != len(dbf.FieldDescriptors) {
+		t.Fatalf("%d columns, want %d", len(s), len(dbf.FieldDescriptors))
+	}
+	want := Column{Name: "WKR_NR", FieldType: Number, GoType: reflect.TypeOf(0), Width: 4}
+	if !reflect.DeepEqual(s[0], want) {
+		t.Errorf("got %v, want %v", s[0], want)
+	}
+	if i := s.Index("LAND_NAME"); i != 3 || s[i].GoType != reflect.TypeOf("") || s[i].Width != 25 {
+		t.Errorf("LAND_NAME at %d: %v", i, s[i])
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Schema
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, s) {
+		t.Errorf("JSON round trip: got %v, want %v", decoded, s)
+	}
+
+	// a new file built from a changed schema
+	to := append(Schema{}, s[0], s[3])
+	to[0].Width = 6
+	to = append(to, Column{Name: "AREA", FieldType: Float, Width: 19, Precision: 6})
+	out := new(memFile)
+	w, err := NewDBFWriter(out, to.Fields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	written, err := OpenDBFFile(out.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	to[2].GoType = reflect.TypeOf(0.)
+	if !reflect.DeepEqual(written.Schema, to) {
+		t.Errorf("written schema:\n%vwant:\n%v", written.Schema, to)
+	}
+
+	var kinds []SchemaChangeKind
+	var names []string
+	for _, c := range s.Diff(written.Schema) {
+		kinds = append(kinds, c.Kind)
+		names = append(names, c.Name)
+	}
+	if !reflect.DeepEqual(kinds, []SchemaChangeKind{ColumnRetyped, ColumnRemoved, ColumnRemoved, ColumnAdded}) ||
+		!reflect.DeepEqual(names, []string{"WKR_NR", s[1].Name, s[2].Name, "AREA"}) {
+		t.Errorf("changes %v %v", kinds, names)
+	}
+	if changes := s.Diff(s); changes != nil {
+		t.Errorf("changes against itself: %v", changes)
+	}
+
+	// dBASE III files have no null values
+	if fd := (Column{Name: "N", FieldType: Number, Width: 4, Nullable: true}).Field(); fd.FlagSetField != 0 {
+		t.Errorf("nullable flag written: %#x", fd.FlagSetField)
+	}
+}
@@ -0,0 +1,333 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// Point is a point in the XY plane.
+type Point struct {
+	X, Y float64
+}
+
+// Box is an XY bounding box.
+type Box struct {
+	Xmin, Ymin, Xmax, Ymax float64
+}
+
+// Shape is the content of a record laid out as in the shapefile
+// specification. Parts holds the index in Points of the first point of
+// each part; it is empty for points and multipoints. Z and M, if not
+// nil, run parallel to Points. M is nil for Z records that end without
+// M values.
+//
+// When writing, Box, ZRange and MRange are computed from the points and
+// need not be set.
+type Shape struct {
+	Type   ShapeType
+	Box    Box
+	Parts  []int32
+	Points []Point
+	Z, M   []float64
+	ZRange *Range // nil without Z values
+	MRange *Range // nil without M values, or with only "no data"
+}
+
+// Part returns the range of Points making up part i.
+func (s *Shape) Part(i int) (start, end int) {
+	start, end = int(s.Parts[i]), len(s.Points)
+	if i+1 < len(s.Parts) {
+		end = int(s.Parts[i+1])
+	}
+	return
+}
+
+// rings returns the parts of s.
+func (s *Shape) rings() [][]geom.Point {
+	return partRings(s.Parts, s.Points)
+}
+
+func partRings[P ~struct{ X, Y float64 }](parts []int32, points []P) [][]geom.Point {
+	rings := make([][]geom.Point, len(parts))
+	for i := range parts {
+		end := len(points)
+		if i+1 < len(parts) {
+			end = int(parts[i+1])
+		}
+		rings[i] = make([]geom.Point, 0, end-int(parts[i]))
+		for _, p := range points[parts[i]:end] {
+			rings[i] = append(rings[i], geom.Point(p))
+		}
+	}
+	return rings
+}
+
+// Polygons groups the rings of a polygon shape into polygons. Each
+// polygon is given as the indices in Parts of its exterior ring followed
+// by its holes. Rings are told apart by nesting rather than orientation:
+// a ring inside an odd number of other rings is a hole, and belongs to
+// the smallest exterior ring around it.
+func (s *Shape) Polygons() [][]int {
+	rings := s.rings()
+	var polygons [][]int
+	var holes []int
+	for i := range rings {
+		if ringIsHole(rings, i) {
+			holes = append(holes, i)
+		} else {
+			polygons = append(polygons, []int{i})
+		}
+	}
+	exteriors := len(polygons)
+	for _, h := range holes {
+		best, area := -1, math.Inf(1)
+		for k, pg := range polygons[:exteriors] {
+			r := rings[pg[0]]
+			a := math.Abs(signedArea(r))
+			if a < area && len(rings[h]) > 0 && pointInRings(rings[h][0], [][]geom.Point{r}) {
+				best, area = k, a
+			}
+		}
+		if best < 0 {
+			// a hole in nothing stands on its own
+			polygons = append(polygons, []int{h})
+			continue
+		}
+		polygons[best] = append(polygons[best], h)
+	}
+	return polygons
+}
+
+// orient reverses the rings of a polygon shape that do not follow o.
+func (s *Shape) orient(o Orientation, write bool) {
+	if s.Type.baseType() != POLYGON || o == FileOrientation {
+		return
+	}
+	reverse := ringsReverse(s.rings(), o, write)
+	reverseParts(s.Points, s.Parts, reverse)
+	reverseParts(s.Z, s.Parts, reverse)
+	reverseParts(s.M, s.Parts, reverse)
+}
+
+// reverseParts reverses the parts of values for which reverse is set.
+// values may be nil.
+func reverseParts[P any](values []P, parts []int32, reverse []bool) {
+	if values == nil {
+		return
+	}
+	for i, start := range parts {
+		if !reverse[i] {
+			continue
+		}
+		end := len(values)
+		if i+1 < len(parts) {
+			end = int(parts[i+1])
+		}
+		for a, b := int(start), end-1; a < b; a, b = a+1, b-1 {
+			values[a], values[b] = values[b], values[a]
+		}
+	}
+}
+
+// decodeShape decodes the content of a record, which must be exactly the
+// ContentLength bytes following the record header.
+func decodeShape(buf []byte) (*Shape, error) {
+	d := &decoder{buf: buf}
+	s := &Shape{Type: ShapeType(d.int32())}
+	if d.err != nil {
+		return nil, d.err
+	}
+	switch s.Type.baseType() {
+	case NULL_SHAPE:
+		if s.Type != NULL_SHAPE {
+			return nil, fmt.Errorf("unknown shape type: %d", s.Type)
+		}
+		return s, nil
+	case POINT:
+		p := Point{X: d.float64(), Y: d.float64()}
+		s.Points = []Point{p}
+		s.Box = Box{Xmin: p.X, Ymin: p.Y, Xmax: p.X, Ymax: p.Y}
+		if s.Type.hasZ() {
+			s.Z = []float64{d.float64()}
+			s.ZRange = &Range{Min: s.Z[0], Max: s.Z[0]}
+		}
+		if s.Type.hasM() && (!s.Type.hasZ() || d.more(8)) {
+			s.M = []float64{d.float64()}
+			s.MRange = mRange(s.M[0], s.M[0])
+		}
+		return s, d.err
+	case MULTI_POINT:
+		s.Box = Box{Xmin: d.float64(), Ymin: d.float64(), Xmax: d.float64(), Ymax: d.float64()}
+		n := d.int32()
+		if d.count("NumPoints", n, 16, 0) {
+			s.Points = d.xy(n)
+		}
+	case POLY_LINE, POLYGON:
+		s.Box = Box{Xmin: d.float64(), Ymin: d.float64(), Xmax: d.float64(), Ymax: d.float64()}
+		nprts, npts := d.int32(), d.int32()
+		if d.count("NumParts", nprts, 4, 0) {
+			d.count("NumPoints", npts, 16, 4*int(nprts))
+		}
+		s.Parts = d.int32s(nprts)
+		s.Points = d.xy(npts)
+		if d.err == nil {
+			d.err = checkParts(s.Parts, npts)
+		}
+	default:
+		return nil, fmt.Errorf("unknown shape type: %d", s.Type)
+	}
+	if s.Type.hasZ() {
+		d.zrange()
+		s.Z = d.float64s(len(s.Points))
+	}
+	// the M values of Z records are optional
+	if s.Type.hasM() && (!s.Type.hasZ() || d.err != nil || d.more(16+8*len(s.Points))) {
+		d.mrange()
+		s.M = d.float64s(len(s.Points))
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	s.ZRange, s.MRange = d.z, d.m
+	return s, nil
+}
+
+func (d *decoder) xy(n int32) []Point {
+	if !d.need(16 * int(n)) {
+		return nil
+	}
+	v := make([]Point, n)
+	for i := range v {
+		v[i].X = math.Float64frombits(l.Uint64(d.buf[d.off:]))
+		v[i].Y = math.Float64frombits(l.Uint64(d.buf[d.off+8:]))
+		d.off += 16
+	}
+	return v
+}
+
+// data converts s into the layout used by ShapefileWriter, copying its
+// values.
+func (s *Shape) data() (*shapeData, error) {
+	d := &shapeData{typ: s.Type}
+	n := len(s.Points)
+	if s.Z != nil && len(s.Z) != n || s.M != nil && len(s.M) != n {
+		return nil, fmt.Errorf("%d Z and %d M values for %d points", len(s.Z), len(s.M), n)
+	}
+	switch s.Type.baseType() {
+	case NULL_SHAPE:
+		return d, nil
+	case POINT:
+		if n != 1 {
+			return nil, fmt.Errorf("%s shape with %d points", s.Type, n)
+		}
+	case POLY_LINE, POLYGON:
+		if err := checkParts(s.Parts, int32(n)); err != nil {
+			return nil, err
+		}
+		d.parts = append([]int32(nil), s.Parts...)
+	}
+	d.points = make([]geom.Point, n)
+	for i, p := range s.Points {
+		d.points[i] = geom.Point(p)
+	}
+	d.z = append([]float64(nil), s.Z...)
+	d.m = append([]float64(nil), s.M...)
+	return d, nil
+}
+
+// Factory converts between the shapes of records and the geometries of
+// a geometry model G. Reader and Writer decode and encode records as
+// Shapes and hand them to a Factory, so records are converted once,
+// from the Shape to G. NextRecord decodes records the same way, with
+// the Gogeom factory.
+type Factory[G any] interface {
+	// Geometry returns the geometry of s. s is not used by the caller
+	// afterwards, so its slices may be kept.
+	Geometry(s *Shape) (G, error)
+	// Shape returns the shape of g. Its slices are not modified.
+	Shape(g G) (*Shape, error)
+}
+
+// Native is the Factory whose geometries are the shapes themselves.
+type Native struct{}
+
+func (Native) Geometry(s *Shape) (*Shape, error) { return s, nil }
+
+func (Native) Shape(s *Shape) (*Shape, error) {
+	if s == nil {
+		return &Shape{Type: NULL_SHAPE}, nil
+	}
+	return s, nil
+}
+
+// Reader reads the records of a Shapefile as geometries of the model of
+// a Factory.
+type Reader[G any] struct {
+	s *Shapefile
+	f Factory[G]
+}
+
+// NewReader returns a Reader of the records of s. Polygons are oriented
+// as set by s.SetOrientation, and lenient mode applies as for
+// NextRecord.
+func NewReader[G any](s *Shapefile, f Factory[G]) *Reader[G] {
+	return &Reader[G]{s: s, f: f}
+}
+
+// Next returns the geometry of the next record. If end of file,
+// err=io.EOF.
+func (r *Reader[G]) Next() (g G, err error) {
+	s := r.s
+	for {
+		if _, s.buf, err = s.readRecord(s.buf); err == nil {
+			var sh *Shape
+			if sh, err = decodeShape(s.buf); err == nil {
+				sh.orient(s.orientation, false)
+				g, err = r.f.Geometry(sh)
+			}
+			if err != nil {
+				err = &RecordError{Kind: KindShp, Record: s.n, Offset: s.last, Err: err}
+			}
+		}
+		if err == nil {
+			return
+		}
+		if err = s.recover(err); err != nil {
+			return
+		}
+	}
+}
+
+// Writer writes geometries of the model of a Factory to a
+// ShapefileWriter.
+type Writer[G any] struct {
+	w *ShapefileWriter
+	f Factory[G]
+}
+
+// NewWriter returns a Writer to w. Polygons are oriented as set by
+// w.SetOrientation. w must still be closed after writing.
+func NewWriter[G any](w *ShapefileWriter, f Factory[G]) *Writer[G] {
+	return &Writer[G]{w: w, f: f}
+}
+
+// Write appends g as the next record.
+func (w *Writer[G]) Write(g G) error {
+	s, err := w.f.Shape(g)
+	if err != nil {
+		return err
+	}
+	d, err := s.data()
+	if err != nil {
+		return err
+	}
+	if d.typ.baseType() == POLYGON && w.w.orientation != FileOrientation {
+		reverse := ringsReverse(partRings(d.parts, d.points), w.w.orientation, true)
+		reverseParts(d.points, d.parts, reverse)
+		reverseParts(d.z, d.parts, reverse)
+		reverseParts(d.m, d.parts, reverse)
+	}
+	return w.w.writeShapeData(d)
+}
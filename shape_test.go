@@ -0,0 +1,131 @@
+package shapefile
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// squareShape returns the points of a closed counter-clockwise square.
+func squareShape(x, y, size float64) []Point {
+	return []Point{{x, y}, {x + size, y}, {x + size, y + size}, {x, y + size}, {x, y}}
+}
+
+func TestNativeShapes(t *testing.T) {
+	// two clockwise exterior rings, the first with a counter-clockwise
+	// hole
+	var pts []Point
+	var parts []int32
+	for k, r := range [][]Point{squareShape(0, 0, 3), squareShape(10, 0, 1), squareShape(1, 1, 1)} {
+		parts = append(parts, int32(len(pts)))
+		for i := range r {
+			if k < 2 {
+				i = len(r) - 1 - i
+			}
+			pts = append(pts, r[i])
+		}
+	}
+	z := make([]float64, len(pts))
+	for i := range z {
+		z[i] = float64(i)
+	}
+	shapes := []*Shape{
+		{Type: POLYGON_Z, Parts: parts, Points: pts, Z: z},
+		nil,
+		{Type: POINT_Z, Points: []Point{{1, 2}}, Z: []float64{3}},
+	}
+
+	shp := new(memFile)
+	sw, err := NewShapefileWriter(shp, nil, POLYGON_Z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter[*Shape](sw, Native{})
+	for _, s := range shapes[:2] {
+		if err = w.Write(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Write(shapes[2]); err == nil {
+		t.Errorf("wrote a point to a polygon file")
+	}
+	if err = sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenShapefile(shp.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetOrientation(FileOrientation)
+	r := NewReader[*Shape](s, Native{})
+	got, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := shapes[0]
+	if got.Type != want.Type || !reflect.DeepEqual(got.Parts, want.Parts) ||
+		!reflect.DeepEqual(got.Points, want.Points) || !reflect.DeepEqual(got.Z, want.Z) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got.Box != (Box{0, 0, 11, 3}) || *got.ZRange != (Range{0, 14}) || *got.MRange != (Range{0, 0}) {
+		t.Errorf("box %v, Z range %v, M range %v", got.Box, got.ZRange, got.MRange)
+	}
+	if p := got.Polygons(); !reflect.DeepEqual(p, [][]int{{0, 2}, {1}}) {
+		t.Errorf("polygons %v", p)
+	}
+	if got, err = r.Next(); err != nil || got.Type != NULL_SHAPE {
+		t.Errorf("got %+v, %v, want a null shape", got, err)
+	}
+	if _, err = r.Next(); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+}
+
+func TestShapeOrientation(t *testing.T) {
+	s := &Shape{Type: POLYGON_M, Parts: []int32{0}, Points: squareShape(0, 0, 1),
+		M: []float64{0, 1, 2, 3, 4}}
+	s.orient(ClockwiseExterior, false)
+	if signedArea(s.rings()[0]) >= 0 {
+		t.Errorf("exterior ring not clockwise: %v", s.Points)
+	}
+	if s.Points[1] != (Point{0, 1}) || s.M[1] != 3 {
+		t.Errorf("M values do not follow their points: %v %v", s.Points, s.M)
+	}
+}
+
+func TestGogeomShapes(t *testing.T) {
+	ring := []geom.PointM{{X: 0, Y: 0, M: 1}, {X: 0, Y: 1, M: 2}, {X: 1, Y: 1, M: 3}, {X: 0, Y: 0, M: 1}}
+	for _, g := range []geom.T{
+		nil,
+		geom.Point{X: 1, Y: 2},
+		&geom.PointM{X: 1, Y: 2, M: 3},
+		geom.PointZM{X: 1, Y: 2, Z: 3, M: 4},
+		geom.MultiPoint{Points: []geom.Point{{X: 1, Y: 2}, {X: 3, Y: 4}}},
+		geom.MultiLineStringZM{LineStrings: []geom.LineStringZM{
+			{Points: []geom.PointZM{{X: 0, Y: 0, Z: 1, M: 2}, {X: 1, Y: 1, Z: 3, M: 4}}},
+			{Points: []geom.PointZM{{X: 2, Y: 2, Z: 5, M: 6}, {X: 3, Y: 3, Z: 7, M: 8}}},
+		}},
+		geom.PolygonM{Rings: [][]geom.PointM{ring}},
+	} {
+		s, err := Gogeom{}.Shape(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Gogeom{}.Geometry(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, g) {
+			t.Errorf("%s: got %#v, want %#v", s.Type, got, g)
+		}
+	}
+
+	// Z records without M values
+	got, err := Gogeom{}.Geometry(&Shape{Type: POINT_Z, Points: []Point{{1, 2}}, Z: []float64{3}})
+	if want := (geom.PointZM{X: 1, Y: 2, Z: 3, M: missingM}); err != nil || got != want {
+		t.Errorf("got %#v, %v, want %#v", got, err, want)
+	}
+}
@@ -1,30 +1,131 @@
 package shapefile
 
 import (
-	"github.com/twpayne/gogeom/geom"
+	"bufio"
 	"io"
+	"math"
+
+	"github.com/twpayne/gogeom/geom"
 )
 
 type Shapefile struct {
 	Header *ShapefileHeader
-	rdr    io.Reader
-	i      int32 // file cursor [words]
+	rdr    *countingReader
+	i      int32  // file cursor [words]
+	buf    []byte // record content, reused between records
+	n      int    // number of records read
+	num    int32  // number of the last record whose header was read
+	last   int64  // byte offset of the last record read
+
+	lenient     *LenientOptions // nil unless in lenient mode
+	warnings    []error
+	orientation Orientation
+}
+
+// countingReader is a buffered reader that keeps track of its offset in
+// the file. Bytes handed back with unread are read again first.
+type countingReader struct {
+	r      *bufio.Reader
+	off    int64
+	replay []byte // bytes to read before those of r
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	if len(r.replay) > 0 {
+		n = copy(p, r.replay)
+		r.replay = r.replay[n:]
+	} else {
+		n, err = r.r.Read(p)
+	}
+	r.off += int64(n)
+	return
+}
+
+func (r *countingReader) Peek(n int) ([]byte, error) {
+	if len(r.replay) >= n {
+		return r.replay[:n], nil
+	} else if len(r.replay) == 0 {
+		return r.r.Peek(n)
+	}
+	rest, err := r.r.Peek(n - len(r.replay))
+	return append(r.replay[:len(r.replay):len(r.replay)], rest...), err
+}
+
+func (r *countingReader) Discard(n int) (discarded int, err error) {
+	discarded = min(n, len(r.replay))
+	r.replay = r.replay[discarded:]
+	r.off += int64(discarded)
+	if n > discarded {
+		var m int
+		m, err = r.r.Discard(n - discarded)
+		discarded += m
+		r.off += int64(m)
+	}
+	return
+}
+
+// unread hands back p, the bytes just read, to be read again. The
+// reader keeps p.
+func (r *countingReader) unread(p []byte) {
+	r.replay = append(p, r.replay...)
+	r.off -= int64(len(p))
 }
 
 type ShapefileRecord struct {
 	Type     ShapeType
 	header   *shapefileRecordHeader
-	Bounds   *geom.Bounds
+	Bounds   *geom.Bounds // XY extent; a single point for points
+	ZRange   *Range       // nil for records without Z values
+	MRange   *Range       // nil for records without M values, or only "no data"
 	Geometry geom.T
+
+	offset int64 // byte offset of the record header
+	index  int   // position in the file, counting from zero
+}
+
+// Number returns the record number stored in the header of the record,
+// counting from one. Records that were not read from a file have zero
+// Number, Offset, ContentLength and FeatureID.
+func (rec *ShapefileRecord) Number() int32 {
+	if rec.header == nil {
+		return 0
+	}
+	return rec.header.RecordNumber
+}
+
+// Offset returns the byte offset of the record header in the .shp file.
+func (rec *ShapefileRecord) Offset() int64 {
+	return rec.offset
 }
 
-// Open shapefile for reading.
+// ContentLength returns the length in bytes of the record content.
+func (rec *ShapefileRecord) ContentLength() int {
+	if rec.header == nil {
+		return 0
+	}
+	return 2 * int(rec.header.ContentLength)
+}
+
+// FeatureID returns the position of the record in the file, counting
+// from zero, which is also the index of its row in the .dbf file. Unlike
+// Number, it does not depend on the record numbers stored in the file.
+// Records skipped in lenient mode are counted.
+func (rec *ShapefileRecord) FeatureID() int {
+	return rec.index
+}
+
+// Open shapefile for reading. Reads are buffered, so rdr does not need
+// to be.
 func OpenShapefile(rdr io.Reader) (s *Shapefile, err error) {
 	s = &Shapefile{}
-	s.rdr = rdr
+	br, ok := rdr.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(rdr, 64*1024)
+	}
+	s.rdr = &countingReader{r: br}
 
 	var h *ShapefileHeader
-	if h, err = newShapefileHeaderFromReader(s.rdr); err != nil {
+	if h, err = newShapefileHeaderFromReader(s.rdr, KindShp); err != nil {
 		return
 	}
 
@@ -33,19 +134,99 @@ func OpenShapefile(rdr io.Reader) (s *Shapefile, err error) {
 	return
 }
 
+// SetOrientation sets how the rings of polygons are oriented as records
+// are read. It defaults to DefaultOrientation.
+func (s *Shapefile) SetOrientation(o Orientation) {
+	s.orientation = o
+}
+
+// Offset returns the byte offset in the file of the next record.
+func (s *Shapefile) Offset() int64 {
+	return s.rdr.off
+}
+
 // Get next record in file. If end of file, err=io.EOF.
+// In lenient mode, records that cannot be read are skipped.
 func (s *Shapefile) NextRecord() (rec *ShapefileRecord, err error) {
-	rec = new(ShapefileRecord)
+	for {
+		rec = new(ShapefileRecord)
+		if rec.header, s.buf, err = s.readRecord(s.buf); err == nil {
+			rec.offset, rec.index = s.last, s.n-1
+			if err = rec.recordContent(s.buf, s.orientation); err != nil {
+				err = &RecordError{Kind: KindShp, Record: s.n, Offset: s.last, Err: err}
+			}
+		}
+		if err == nil {
+			return
+		}
+		if err = s.recover(err); err != nil {
+			return
+		}
+	}
+}
+
+// readRecord reads the header and content of the next record, storing
+// the content in buf, which is grown as needed. Errors other than io.EOF
+// are *RecordError.
+func (s *Shapefile) readRecord(buf []byte) (hdr *shapefileRecordHeader,
+	content []byte, err error) {
 	if s.i <= 0 {
-		err = io.EOF
-		return
+		return nil, buf, io.EOF
 	}
-	if rec.header, err = newShapefileRecordHeaderFromReader(s.rdr); err != nil {
-		return
+	s.n++
+	s.last = s.rdr.off
+	fail := func(err error) error {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &RecordError{Kind: KindShp, Record: s.n, Offset: s.last, Err: err}
 	}
-	if err = rec.recordContent(s.rdr); err != nil {
-		return
+	if cap(buf) < 8 {
+		buf = make([]byte, 8, 64)
 	}
-	s.i = s.i - rec.header.ContentLength - 4
-	return
+	if hdr, err = newShapefileRecordHeaderFromReader(s.rdr, buf[:8]); err == io.EOF {
+		s.n--
+		return nil, buf, err // the file ends early, but between records
+	} else if err != nil {
+		return nil, buf, fail(err)
+	}
+	max := int64(math.MaxInt32)
+	if s.lenient != nil {
+		// do not read past the end of the file to find out
+		max = int64(s.i) - 4
+	}
+	if hdr.ContentLength < 2 || int64(hdr.ContentLength) > max {
+		return hdr, buf, fail(&LengthError{Field: "ContentLength",
+			Value: int64(hdr.ContentLength), Min: 2, Max: max})
+	}
+	if buf, err = readContent(s.rdr, buf, 2*int(hdr.ContentLength)); err != nil {
+		return hdr, buf, fail(err)
+	}
+	s.i = s.i - hdr.ContentLength - 4
+	s.num = hdr.RecordNumber
+	return hdr, buf, nil
+}
+
+// maxChunk is the largest amount of memory allocated for record content
+// ahead of reading it, so that a corrupt content length cannot cause a
+// huge allocation for a small file.
+const maxChunk = 1 << 20
+
+// readContent reads n bytes from r into buf, which is grown as needed.
+func readContent(r io.Reader, buf []byte, n int) ([]byte, error) {
+	for have := 0; have < n; {
+		m := min(n, have+maxChunk)
+		if cap(buf) < m {
+			buf = append(buf[:cap(buf)], make([]byte, m-cap(buf))...)
+		}
+		buf = buf[:m]
+		if _, err := io.ReadFull(r, buf[have:m]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf, err
+		}
+		have = m
+	}
+	return buf[:n], nil
 }
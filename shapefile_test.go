@@ -0,0 +1,70 @@
+package shapefile
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestRecordMetadata(t *testing.T) {
+	f, err := os.Open(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, err := OpenShapefile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenMapped(testBasename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	for i := 0; ; i++ {
+		off := s.Offset()
+		rec, err := s.NextRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if rec.FeatureID() != i || rec.Number() != int32(i+1) || rec.Offset() != off ||
+			s.Offset() != off+8+int64(rec.ContentLength()) {
+			t.Fatalf("record %d: id %d, number %d, offset %d, length %d", i,
+				rec.FeatureID(), rec.Number(), rec.Offset(), rec.ContentLength())
+		}
+		v, err := m.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mrec, err := v.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mrec.FeatureID() != i || mrec.Offset() != off || mrec.ContentLength() != rec.ContentLength() {
+			t.Fatalf("mapped record %d: id %d, offset %d", i, mrec.FeatureID(), mrec.Offset())
+		}
+	}
+}
+
+func TestRecordMetadataLenient(t *testing.T) {
+	data, index := brokenFile(t, 10)
+	s, err := OpenShapefile((&memFile{buf: data}).reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetLenient(LenientOptions{Index: index})
+	for {
+		rec, err := s.NextRecord()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		// square i starts at x = i
+		if id := rec.FeatureID(); float64(id) != rec.Bounds.Min.X || rec.Offset() != index[id].Offset {
+			t.Errorf("record at x = %g: id %d, offset %d", rec.Bounds.Min.X, id, rec.Offset())
+		}
+	}
+}
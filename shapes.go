@@ -3,372 +3,277 @@ package shapefile
 import (
 	"encoding/binary"
 	"fmt"
-	"github.com/twpayne/gogeom/geom"
-	"github.com/ctessum/geomop"
 	"io"
+	"math"
+
+	"github.com/twpayne/gogeom/geom"
 )
 
 var l = binary.LittleEndian
 var b = binary.BigEndian
 
-func (rec *ShapefileRecord) recordContent(r io.Reader) (err error) {
-	if err = binary.Read(r, l, &rec.Type); err != nil {
-		return
+// decoder reads little endian values from the content of a record. The
+// first read past the end of the content sets err, after which all reads
+// return zero values.
+type decoder struct {
+	buf  []byte
+	off  int
+	err  error
+	z, m *Range // ranges read from the content
+}
+
+func (d *decoder) need(n int) bool {
+	if d.err != nil {
+		return false
 	}
-	// this implementation does not enforce the rule that all
-	// records in a file must be the same type.
-	switch rec.Type {
-	case NULL_SHAPE:
-		rec.Geometry, rec.Bounds, err = readNull(r)
-	case POINT:
-		rec.Geometry, rec.Bounds, err = readPoint(r)
-	case POLY_LINE:
-		rec.Geometry, rec.Bounds, err = readPolyLine(r)
-	case POLYGON:
-		rec.Geometry, rec.Bounds, err = readPolygon(r)
-		geomop.FixOrientation(rec.Geometry)
-	case MULTI_POINT:
-		rec.Geometry, rec.Bounds, err = readMultiPoint(r)
-	case POINT_Z:
-		rec.Geometry, rec.Bounds, err = readPointZ(r)
-	case POLY_LINE_Z:
-		rec.Geometry, rec.Bounds, err = readPolyLineZ(r)
-	case POLYGON_Z:
-		rec.Geometry, rec.Bounds, err = readPolygonZ(r)
-	case MULTI_POINT_Z:
-		rec.Geometry, rec.Bounds, err = readMultiPointZ(r)
-	case POINT_M:
-		rec.Geometry, rec.Bounds, err = readPointM(r)
-	case POLY_LINE_M:
-		rec.Geometry, rec.Bounds, err = readPolyLineM(r)
-	case POLYGON_M:
-		rec.Geometry, rec.Bounds, err = readPolygonM(r)
-	case MULTI_POINT_M:
-		rec.Geometry, rec.Bounds, err = readMultiPointM(r)
-	// drop multipatch capability for now because don't know
-	// what to do with the triangle patches.
-	//case MULTI_PATCH:
-	//	rec.Geometry, rec.Bounds, err = readMultiPatch(r)
-	default:
-		err = fmt.Errorf("unknown shape type: %d", rec.Type)
-		return
+	if n < 0 || n > len(d.buf)-d.off {
+		d.err = io.ErrUnexpectedEOF
+		return false
 	}
-	return
+	return true
 }
 
-func readNull(r io.Reader) (geom.T, *geom.Bounds, error) {
-	return nil, nil, nil
+// count checks that n items of size bytes each fit in the rest of the
+// content, after reserved bytes that must follow them.
+func (d *decoder) count(field string, n int32, size, reserved int) bool {
+	if d.err != nil {
+		return false
+	}
+	max := (len(d.buf) - d.off - reserved) / size
+	if n < 0 || int(n) > max {
+		d.err = &LengthError{Field: field, Value: int64(n), Max: int64(max)}
+		return false
+	}
+	return true
 }
 
-func readPoint(r io.Reader) (geom.T, *geom.Bounds, error) {
-	p := new(geom.Point)
-	err := binary.Read(r, binary.LittleEndian, p)
-	return *p, nil, err
+func (d *decoder) int32() int32 {
+	if !d.need(4) {
+		return 0
+	}
+	v := int32(l.Uint32(d.buf[d.off:]))
+	d.off += 4
+	return v
 }
 
-// reads a succession of numPoints, Point[numPoints]...
-func readNumPoints(r io.Reader) (points []geom.Point, err error) {
-	var i int32
-	if err = binary.Read(r, l, &i); err != nil {
-		return
+func (d *decoder) float64() float64 {
+	if !d.need(8) {
+		return 0
 	}
-	points = make([]geom.Point, i)
-	err = binary.Read(r, l, points)
-	return
+	v := math.Float64frombits(l.Uint64(d.buf[d.off:]))
+	d.off += 8
+	return v
 }
 
-func readMultiPoint(r io.Reader) (geom.T, *geom.Bounds, error) {
-	mp := new(geom.MultiPoint)
-	bounds := new(geom.Bounds)
-	var err error
-	if err = binary.Read(r, binary.LittleEndian, bounds); err != nil {
-		return nil, nil, err
+func (d *decoder) int32s(n int32) []int32 {
+	if !d.need(4 * int(n)) {
+		return nil
 	}
-	if mp.Points, err = readNumPoints(r); err != nil {
-		return nil, nil, err
+	v := make([]int32, n)
+	for i := range v {
+		v[i] = int32(l.Uint32(d.buf[d.off:]))
+		d.off += 4
 	}
-
-	return *mp, bounds, nil
+	return v
 }
 
-func readBoundsPartsPoints(r io.Reader) (bounds *geom.Bounds,
-	parts []int32, points []geom.Point, err error) {
-	bounds = new(geom.Bounds)
-	if err = binary.Read(r, l, bounds); err != nil {
-		return
-	}
-	var nprts int32
-	var npts int32
-	if err = binary.Read(r, l, &nprts); err != nil {
-		return
-	}
-	if err = binary.Read(r, l, &npts); err != nil {
-		return
+func (d *decoder) float64s(n int) []float64 {
+	if !d.need(8 * n) {
+		return nil
 	}
-
-	parts = make([]int32, nprts)
-	if err = binary.Read(r, l, parts); err != nil {
-		return
+	v := make([]float64, n)
+	for i := range v {
+		v[i] = math.Float64frombits(l.Uint64(d.buf[d.off:]))
+		d.off += 8
 	}
-	points = make([]geom.Point, npts)
-	err = binary.Read(r, l, points)
-	return
+	return v
 }
 
-type xrange struct {
-	min float64
-	max float64
+// more reports whether at least n bytes of content are left. Z records
+// may end without their M values.
+func (d *decoder) more(n int) bool {
+	return len(d.buf)-d.off >= n
 }
 
-func readBoundsPartsPointsM(r io.Reader) (bounds *geom.Bounds,
-	parts []int32, points []geom.Point, M []float64, err error) {
-	bounds, parts, points, err = readBoundsPartsPoints(r)
-	if err != nil {
-		return
-	}
-	mrange := new(xrange)
-	if err = binary.Read(r, l, mrange); err != nil {
-		return
-	}
-	M = make([]float64, len(points))
-	err = binary.Read(r, l, M)
-	return
-}
+// missingM is the M value of the points of Z records without M values.
+// It means "no data".
+const missingM = -math.MaxFloat64
 
-func readBoundsPartsPointsZM(r io.Reader) (bounds *geom.Bounds,
-	parts []int32, points []geom.Point, Z, M []float64, err error) {
-	bounds, parts, points, err = readBoundsPartsPoints(r)
-	if err != nil {
-		return
-	}
-	zrange := new(xrange)
-	if err = binary.Read(r, l, zrange); err != nil {
-		return
-	}
-	Z = make([]float64, len(points))
-	err = binary.Read(r, l, Z)
-	mrange := new(xrange)
-	if err = binary.Read(r, l, mrange); err != nil {
-		return
-	}
-	M = make([]float64, len(points))
-	err = binary.Read(r, l, M)
-	return
+func (d *decoder) zrange() {
+	d.z = &Range{Min: d.float64(), Max: d.float64()}
 }
 
-func getStartEnd(parts []int32, points []geom.Point, i int) (start, end int) {
-	start = int(parts[i])
-	if i == len(parts)-1 {
-		end = len(points)
-	} else {
-		end = int(parts[i+1])
-	}
-	return
+func (d *decoder) mrange() {
+	d.m = mRange(d.float64(), d.float64())
 }
 
-func readPolyLine(r io.Reader) (geom.T, *geom.Bounds, error) {
-	pl := new(geom.MultiLineString)
-	bounds, parts, points, err := readBoundsPartsPoints(r)
-	if err != nil {
-		return nil, nil, err
-	}
-	pl.LineStrings = make([]geom.LineString, len(parts))
-	for i := 0; i < len(parts); i++ {
-		start, end := getStartEnd(parts, points, i)
-		pl.LineStrings[i].Points = make([]geom.Point, end-start)
-		for j := start; j < end; j++ {
-			pl.LineStrings[i].Points[j-start] = points[j]
-		}
+// mRange returns the range of M values from min to max, or nil if they
+// are all "no data".
+func mRange(min, max float64) *Range {
+	if max <= noData {
+		return nil
 	}
-	return *pl, bounds, nil
-
+	return &Range{Min: min, Max: max}
 }
 
-func readPolygon(r io.Reader) (geom.T, *geom.Bounds, error) {
-	pg := new(geom.Polygon)
-	bounds, parts, points, err := readBoundsPartsPoints(r)
+// recordContent decodes the content of a record, which must be exactly
+// the ContentLength bytes following the record header, and orients the
+// rings of polygons following o.
+func (rec *ShapefileRecord) recordContent(buf []byte, o Orientation) error {
+	s, err := decodeShape(buf)
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	s.orient(o, false)
+	if rec.Geometry, err = (Gogeom{}).Geometry(s); err != nil {
+		return err
 	}
-	pg.Rings = make([][]geom.Point, len(parts))
-	for i := 0; i < len(parts); i++ {
-		start, end := getStartEnd(parts, points, i)
-		pg.Rings[i] = make([]geom.Point, end-start)
-		// Go backwards around the rings to switch to OGC format
-		for j := end - 1; j >= start; j-- {
-			pg.Rings[i][j-start] = points[j]
+	rec.Type, rec.ZRange, rec.MRange = s.Type, s.ZRange, s.MRange
+	if s.Type != NULL_SHAPE {
+		rec.Bounds = &geom.Bounds{
+			Min: geom.Point{X: s.Box.Xmin, Y: s.Box.Ymin},
+			Max: geom.Point{X: s.Box.Xmax, Y: s.Box.Ymax},
 		}
 	}
-	return *pg, bounds, nil
+	return nil
 }
 
-func readPointM(r io.Reader) (geom.T, *geom.Bounds, error) {
-	pm := new(geom.PointM)
-	err := binary.Read(r, l, pm)
-	return pm, nil, err
-}
+// Gogeom is the Factory for github.com/twpayne/gogeom geometries, which
+// NextRecord, ShapefileWriter.Write and the rest of the package use.
+// Null shapes are nil. Points become geom.Point, *geom.PointM or
+// geom.PointZM, multipoints geom.MultiPoint, geom.MultiPointM or
+// geom.MultiPointZM, polylines geom.MultiLineString,
+// geom.MultiLineStringM or geom.MultiLineStringZM, and polygons
+// geom.Polygon, geom.PolygonM or geom.PolygonZM. The points of Z records
+// without M values get the "no data" M value -math.MaxFloat64.
+type Gogeom struct{}
 
-func readMultiPointM(r io.Reader) (geom.T, *geom.Bounds, error) {
-	var err error
-	mp := new(geom.MultiPointM)
-	bounds := new(geom.Bounds)
-	if err := binary.Read(r, l, bounds); err != nil {
-		return nil, nil, err
-	}
-	var points []geom.Point
-	if points, err = readNumPoints(r); err != nil {
-		return nil, nil, err
+func (Gogeom) Geometry(s *Shape) (geom.T, error) {
+	M := s.M
+	if s.Type.hasZ() && M == nil {
+		M = make([]float64, len(s.Points))
+		for i := range M {
+			M[i] = missingM
+		}
 	}
-	mr := new(xrange)
-	if err = binary.Read(r, l, mr); err != nil {
-		return nil, nil, err
+	xy := func(i int) geom.Point { return geom.Point(s.Points[i]) }
+	xym := func(i int) geom.PointM {
+		return geom.PointM{X: s.Points[i].X, Y: s.Points[i].Y, M: M[i]}
 	}
-	marray := make([]float64, len(mp.Points))
-	if err = binary.Read(r, l, marray); err != nil {
-		return nil, nil, err
+	xyzm := func(i int) geom.PointZM {
+		return geom.PointZM{X: s.Points[i].X, Y: s.Points[i].Y, Z: s.Z[i], M: M[i]}
 	}
-	mp.Points = make([]geom.PointM, len(points))
-	for i, point := range points {
-		p := new(geom.PointM)
-		p.X = point.X
-		p.Y = point.Y
-		p.M = marray[i]
-		mp.Points[i] = *p
+	switch s.Type {
+	case NULL_SHAPE:
+		return nil, nil
+	case POINT:
+		return xy(0), nil
+	case POINT_M:
+		p := xym(0)
+		return &p, nil
+	case POINT_Z:
+		return xyzm(0), nil
+	case MULTI_POINT:
+		return geom.MultiPoint{Points: allPoints(s, xy)}, nil
+	case MULTI_POINT_M:
+		return geom.MultiPointM{Points: allPoints(s, xym)}, nil
+	case MULTI_POINT_Z:
+		return geom.MultiPointZM{Points: allPoints(s, xyzm)}, nil
+	case POLY_LINE:
+		parts := shapeParts(s, xy)
+		pl := geom.MultiLineString{LineStrings: make([]geom.LineString, len(parts))}
+		for i, p := range parts {
+			pl.LineStrings[i].Points = p
+		}
+		return pl, nil
+	case POLY_LINE_M:
+		parts := shapeParts(s, xym)
+		pl := geom.MultiLineStringM{LineStrings: make([]geom.LineStringM, len(parts))}
+		for i, p := range parts {
+			pl.LineStrings[i].Points = p
+		}
+		return pl, nil
+	case POLY_LINE_Z:
+		parts := shapeParts(s, xyzm)
+		pl := geom.MultiLineStringZM{LineStrings: make([]geom.LineStringZM, len(parts))}
+		for i, p := range parts {
+			pl.LineStrings[i].Points = p
+		}
+		return pl, nil
+	case POLYGON:
+		return geom.Polygon{Rings: shapeParts(s, xy)}, nil
+	case POLYGON_M:
+		return geom.PolygonM{Rings: shapeParts(s, xym)}, nil
+	case POLYGON_Z:
+		return geom.PolygonZM{Rings: shapeParts(s, xyzm)}, nil
 	}
-	return *mp, bounds, nil
+	return nil, fmt.Errorf("unknown shape type: %d", s.Type)
 }
 
-func readPolyLineM(r io.Reader) (geom.T, *geom.Bounds, error) {
-	pl := new(geom.MultiLineStringM)
-	bounds, parts, points, M, err := readBoundsPartsPointsM(r)
+// Shape returns the shape of g, which may be any of the geometries
+// accepted by ShapefileWriter.Write. Rings keep their orientation.
+func (Gogeom) Shape(g geom.T) (*Shape, error) {
+	d, err := newShapeData(g, FileOrientation)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	pl.LineStrings = make([]geom.LineStringM, len(parts))
-	for i := 0; i < len(parts); i++ {
-		start, end := getStartEnd(parts, points, i)
-		pl.LineStrings[i].Points = make([]geom.PointM, end-start)
-		for j := start; j < end; j++ {
-			p := new(geom.PointM)
-			p.X = points[j].X
-			p.Y = points[j].Y
-			p.M = M[j]
-			pl.LineStrings[i].Points[j-start] = *p
-		}
+	s := &Shape{Type: d.typ, Parts: d.parts, Points: make([]Point, len(d.points))}
+	for i, p := range d.points {
+		s.Points[i] = Point(p)
 	}
-	return *pl, bounds, nil
-}
-
-func readPolygonM(r io.Reader) (geom.T, *geom.Bounds, error) {
-	pg := new(geom.PolygonM)
-	bounds, parts, points, M, err := readBoundsPartsPointsM(r)
-	if err != nil {
-		return nil, nil, err
+	if d.typ.hasZ() {
+		s.Z = d.z
 	}
-	pg.Rings = make([][]geom.PointM, len(parts))
-	for i := 0; i < len(parts); i++ {
-		start, end := getStartEnd(parts, points, i)
-		pg.Rings[i] = make([]geom.PointM, end-start)
-		// Go backwards around the rings to switch to OGC format
-		for j := end - 1; j >= start; j-- {
-			p := new(geom.PointM)
-			p.X = points[j].X
-			p.Y = points[j].Y
-			p.M = M[j]
-			pg.Rings[i][j-start] = *p
-		}
+	if d.typ.hasM() {
+		s.M = d.m
 	}
-	return *pg, bounds, nil
+	return s, nil
 }
 
-func readPointZ(r io.Reader) (geom.T, *geom.Bounds, error) {
-	pzm := new(geom.PointZM)
-	err := binary.Read(r, l, pzm)
-	return *pzm, nil, err
-}
-
-func readMultiPointZ(r io.Reader) (geom.T, *geom.Bounds, error) {
-	var err error
-	mp := new(geom.MultiPointZM)
-	bounds := new(geom.Bounds)
-	if err := binary.Read(r, l, bounds); err != nil {
-		return nil, nil, err
-	}
-	var points []geom.Point
-	if points, err = readNumPoints(r); err != nil {
-		return nil, nil, err
+// allPoints returns the points of s converted by at.
+func allPoints[P any](s *Shape, at func(i int) P) []P {
+	points := make([]P, len(s.Points))
+	for i := range points {
+		points[i] = at(i)
 	}
-	zr := new(xrange)
-	if err = binary.Read(r, l, zr); err != nil {
-		return nil, nil, err
-	}
-	zarray := make([]float64, len(mp.Points))
-	if err = binary.Read(r, l, zarray); err != nil {
-		return nil, nil, err
-	}
-	mr := new(xrange)
-	if err = binary.Read(r, l, mr); err != nil {
-		return nil, nil, err
-	}
-	marray := make([]float64, len(mp.Points))
-	if err = binary.Read(r, l, marray); err != nil {
-		return nil, nil, err
-	}
-	mp.Points = make([]geom.PointZM, len(points))
-	for i, point := range points {
-		p := new(geom.PointZM)
-		p.X = point.X
-		p.Y = point.Y
-		p.Z = zarray[i]
-		p.M = marray[i]
-		mp.Points[i] = *p
-	}
-	return *mp, bounds, nil
+	return points
 }
 
-func readPolyLineZ(r io.Reader) (geom.T, *geom.Bounds, error) {
-	pl := new(geom.MultiLineStringZM)
-	bounds, parts, points, Z, M, err := readBoundsPartsPointsZM(r)
-	if err != nil {
-		return nil, nil, err
-	}
-	pl.LineStrings = make([]geom.LineStringZM, len(parts))
-	for i := 0; i < len(parts); i++ {
-		start, end := getStartEnd(parts, points, i)
-		pl.LineStrings[i].Points = make([]geom.PointZM, end-start)
+// shapeParts returns the points of each part of s converted by at.
+func shapeParts[P any](s *Shape, at func(i int) P) [][]P {
+	parts := make([][]P, len(s.Parts))
+	for i := range parts {
+		start, end := s.Part(i)
+		parts[i] = make([]P, end-start)
 		for j := start; j < end; j++ {
-			p := new(geom.PointZM)
-			p.X = points[j].X
-			p.Y = points[j].Y
-			p.Z = Z[j]
-			p.M = M[j]
-			pl.LineStrings[i].Points[j-start] = *p
+			parts[i][j-start] = at(j)
 		}
 	}
-	return *pl, bounds, nil
+	return parts
 }
 
-func readPolygonZ(r io.Reader) (geom.T, *geom.Bounds, error) {
-	pg := new(geom.PolygonZM)
-	bounds, parts, points, Z, M, err := readBoundsPartsPointsZM(r)
-	if err != nil {
-		return nil, nil, err
+// getStartEnd returns the range of points making up part i.
+func getStartEnd(parts []int32, points []geom.Point, i int) (start, end int) {
+	start = int(parts[i])
+	if i == len(parts)-1 {
+		end = len(points)
+	} else {
+		end = int(parts[i+1])
 	}
-	pg.Rings = make([][]geom.PointZM, len(parts))
-	for i := 0; i < len(parts); i++ {
-		start, end := getStartEnd(parts, points, i)
-		pg.Rings[i] = make([]geom.PointZM, end-start)
-		// Go backwards around the rings to switch to OGC format
-		for j := end - 1; j >= start; j-- {
-			p := new(geom.PointZM)
-			p.X = points[j].X
-			p.Y = points[j].Y
-			p.Z = Z[j]
-			p.M = M[j]
-			pg.Rings[i][j-start] = *p
+	return
+}
+
+// checkParts checks that part indices are increasing and within the
+// points of the record.
+func checkParts(parts []int32, npts int32) error {
+	var prev int32
+	for i, p := range parts {
+		if p < prev || p > npts {
+			return &PartError{Part: i, Index: p, NumPoints: npts}
 		}
+		prev = p
 	}
-	return *pg, bounds, nil
+	return nil
 }
 
 //type partType int32
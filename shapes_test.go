@@ -0,0 +1,225 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// readAllReflect decodes POINT and POLYGON files the way the package
+// did before records were decoded from byte slices: one binary.Read per
+// value, straight from the reader. It is the baseline for the decoding
+// benchmarks.
+func readAllReflect(r io.Reader) (geoms []geom.T, err error) {
+	hdr, err := newShapefileHeaderFromReader(r, KindShp)
+	if err != nil {
+		return nil, err
+	}
+	for left := hdr.FileLength - 50; left > 0; {
+		var rh struct{ RecordNumber, ContentLength int32 }
+		if err = binary.Read(r, b, &rh); err != nil {
+			return
+		}
+		var t ShapeType
+		if err = binary.Read(r, l, &t); err != nil {
+			return
+		}
+		switch t {
+		case POINT:
+			p := new(geom.Point)
+			if err = binary.Read(r, l, p); err != nil {
+				return
+			}
+			geoms = append(geoms, *p)
+		case POLYGON:
+			bounds := new(geom.Bounds)
+			var nprts, npts int32
+			if err = binary.Read(r, l, bounds); err != nil {
+				return
+			}
+			if err = binary.Read(r, l, &nprts); err != nil {
+				return
+			}
+			if err = binary.Read(r, l, &npts); err != nil {
+				return
+			}
+			parts := make([]int32, nprts)
+			if err = binary.Read(r, l, parts); err != nil {
+				return
+			}
+			points := make([]geom.Point, npts)
+			if err = binary.Read(r, l, points); err != nil {
+				return
+			}
+			pg := geom.Polygon{Rings: make([][]geom.Point, nprts)}
+			for i := range parts {
+				start, end := getStartEnd(parts, points, i)
+				pg.Rings[i] = points[start:end:end]
+			}
+			geoms = append(geoms, pg)
+		}
+		left -= rh.ContentLength + 4
+	}
+	return
+}
+
+func readAll(t testing.TB, data []byte) (geoms []geom.T) {
+	s, err := OpenShapefile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		rec, err := s.NextRecord()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		geoms = append(geoms, rec.Geometry)
+	}
+}
+
+func pointFile(t testing.TB, n int) []byte {
+	shp := new(memFile)
+	w, err := NewShapefileWriter(shp, nil, POINT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err = w.Write(geom.Point{X: float64(i), Y: float64(-i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return shp.buf
+}
+
+func TestDecodePoints(t *testing.T) {
+	data := pointFile(t, 100)
+	got := readAll(t, data)
+	want, err := readAllReflect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded points differ")
+	}
+}
+
+func TestDecodePolygons(t *testing.T) {
+	data, err := os.ReadFile(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readAll(t, data)
+	want, err := readAllReflect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 299 || len(got) != len(want) {
+		t.Fatalf("decoded %d polygons, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if len(got[i].(geom.Polygon).Rings) != len(want[i].(geom.Polygon).Rings) {
+			t.Errorf("polygon %d: ring counts differ", i)
+		}
+	}
+}
+
+func TestDecodeRanges(t *testing.T) {
+	tests := []struct {
+		typ  ShapeType
+		g    geom.T
+		z, m *Range
+	}{
+		{POINT, geom.Point{X: 1, Y: 2}, nil, nil},
+		{POINT_M, geom.PointM{X: 1, Y: 2, M: 4}, nil, &Range{4, 4}},
+		{POINT_Z, geom.PointZM{X: 1, Y: 2, Z: 3, M: 4}, &Range{3, 3}, &Range{4, 4}},
+		{POINT_M, geom.PointM{X: 1, Y: 2, M: -2e38}, nil, nil},
+		{POLY_LINE_Z, geom.MultiLineStringZM{LineStrings: []geom.LineStringZM{{Points: []geom.PointZM{
+			{X: 1, Y: 2, Z: -1, M: 10}, {X: 1, Y: 2, Z: 5, M: 20}}}}}, &Range{-1, 5}, &Range{10, 20}},
+	}
+	for _, test := range tests {
+		shp := new(memFile)
+		w, err := NewShapefileWriter(shp, nil, test.typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Write(test.g); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		s, err := OpenShapefile(shp.reader())
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := s.NextRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := geom.Bounds{Min: geom.Point{X: 1, Y: 2}, Max: geom.Point{X: 1, Y: 2}}
+		if rec.Bounds == nil || *rec.Bounds != want {
+			t.Errorf("%s: bounds %v, want %v", test.typ, rec.Bounds, want)
+		}
+		for _, r := range []struct {
+			name      string
+			got, want *Range
+		}{
+			{"record Z", rec.ZRange, test.z},
+			{"record M", rec.MRange, test.m},
+			{"header Z", s.Header.ZRange(), test.z},
+			{"header M", s.Header.MRange(), test.m},
+		} {
+			if (r.got == nil) != (r.want == nil) || r.got != nil && *r.got != *r.want {
+				t.Errorf("%s: %s range %v, want %v", test.typ, r.name, r.got, r.want)
+			}
+		}
+	}
+}
+
+func benchmarkDecode(bm *testing.B, data []byte, reflected bool) {
+	bm.SetBytes(int64(len(data)))
+	bm.ReportAllocs()
+	for i := 0; i < bm.N; i++ {
+		if reflected {
+			if _, err := readAllReflect(bytes.NewReader(data)); err != nil {
+				bm.Fatal(err)
+			}
+		} else {
+			readAll(bm, data)
+		}
+	}
+}
+
+func polygonData(bm *testing.B) []byte {
+	data, err := os.ReadFile(testfile)
+	if err != nil {
+		bm.Fatal(err)
+	}
+	return data
+}
+
+func BenchmarkDecodePolygons(bm *testing.B) {
+	benchmarkDecode(bm, polygonData(bm), false)
+}
+
+func BenchmarkDecodePolygonsReflect(bm *testing.B) {
+	benchmarkDecode(bm, polygonData(bm), true)
+}
+
+func BenchmarkDecodePoints(bm *testing.B) {
+	benchmarkDecode(bm, pointFile(bm, 100000), false)
+}
+
+func BenchmarkDecodePointsReflect(bm *testing.B) {
+	benchmarkDecode(bm, pointFile(bm, 100000), true)
+}
@@ -0,0 +1,45 @@
+package shapefile
+
+import (
+	"io"
+	"math"
+)
+
+// IndexEntry is a record of a .shx file, locating one record of the
+// .shp file.
+type IndexEntry struct {
+	Offset int64 // byte offset of the record header in the .shp file
+	Length int   // length of the record content in bytes
+}
+
+// ReadIndex reads a .shx file.
+func ReadIndex(r io.Reader) (hdr *ShapefileHeader, entries []IndexEntry, err error) {
+	if hdr, err = newShapefileHeaderFromReader(r, KindShx); err != nil {
+		return
+	}
+	n := int(hdr.FileLength-50) / 4 // each entry is 8 bytes = 4 words
+	if n < 0 {
+		return nil, nil, &HeaderError{Kind: KindShx, Field: "FileLength", Offset: 24,
+			Err: &LengthError{Field: "FileLength", Value: int64(hdr.FileLength),
+				Min: 50, Max: math.MaxInt32}}
+	}
+	buf := make([]byte, 8)
+	for i := 0; i < n; i++ {
+		if _, err = io.ReadFull(r, buf); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return hdr, entries, &RecordError{Kind: KindShx, Record: i + 1,
+				Offset: 100 + 8*int64(i), Err: err}
+		}
+		entries = append(entries, parseIndexEntry(buf))
+	}
+	return
+}
+
+func parseIndexEntry(buf []byte) IndexEntry {
+	return IndexEntry{
+		Offset: 2 * int64(b.Uint32(buf[0:])),
+		Length: 2 * int(b.Uint32(buf[4:])),
+	}
+}
@@ -0,0 +1,355 @@
+package shapefile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Validate checks a shapefile set against the ESRI shapefile technical
+// description and reports every departure from it that it finds as a
+// *HeaderError or *RecordError. shx and dbf may be nil. err is only set
+// if the files cannot be read.
+func Validate(shp, shx, dbf *io.SectionReader) (problems []error, err error) {
+	v := &validator{shp: &readerAtSource{r: shp, n: shp.Size()}}
+	if shx != nil {
+		v.shx = &readerAtSource{r: shx, n: shx.Size()}
+	}
+	if dbf != nil {
+		v.dbf = &readerAtSource{r: dbf, n: dbf.Size()}
+	}
+	if err = v.run(); err != nil {
+		return nil, err
+	}
+	return v.problems, nil
+}
+
+// ValidateFiles validates basename.shp together with basename.shx and
+// basename.dbf, if they exist.
+func ValidateFiles(basename string) (problems []error, err error) {
+	var sections [3]*io.SectionReader
+	for i, ext := range []string{".shp", ".shx", ".dbf"} {
+		f, err := os.Open(basename + ext)
+		if os.IsNotExist(err) && i > 0 {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		sections[i] = io.NewSectionReader(f, 0, fi.Size())
+	}
+	return Validate(sections[0], sections[1], sections[2])
+}
+
+type validator struct {
+	shp, shx, dbf source // shx and dbf may be nil
+	hdr           *ShapefileHeader
+	found         []IndexEntry // records found in the .shp file
+	problems      []error
+}
+
+func (v *validator) header(kind FileKind, field string, off int64, format string, a ...interface{}) {
+	v.problems = append(v.problems, &HeaderError{Kind: kind, Field: field,
+		Offset: off, Err: fmt.Errorf(format, a...)})
+}
+
+func (v *validator) record(kind FileKind, i int, off int64, format string, a ...interface{}) {
+	v.problems = append(v.problems, &RecordError{Kind: kind, Record: i + 1,
+		Offset: off, Err: fmt.Errorf(format, a...)})
+}
+
+func (v *validator) run() error {
+	var err error
+	if v.hdr, err = v.mainHeader(KindShp, v.shp); err != nil || v.hdr == nil {
+		return err
+	}
+	if err = v.records(); err != nil {
+		return err
+	}
+	if v.shx != nil {
+		if err = v.index(); err != nil {
+			return err
+		}
+	}
+	if v.dbf != nil {
+		return v.table()
+	}
+	return nil
+}
+
+// mainHeader checks the header of a .shp or .shx file. hdr is nil if the
+// file is too short to hold one.
+func (v *validator) mainHeader(kind FileKind, src source) (hdr *ShapefileHeader, err error) {
+	if src.size() < 100 {
+		v.header(kind, "", 0, "file is %d bytes, too short for a header", src.size())
+		return nil, nil
+	}
+	buf, err := src.at(0, 100)
+	if err != nil {
+		return nil, err
+	}
+	if code := int32(b.Uint32(buf[0:])); code != 9994 {
+		v.header(kind, "FileCode", 0, "is %d, must be 9994", code)
+	}
+	hdr = &ShapefileHeader{
+		FileLength: int32(b.Uint32(buf[24:])),
+		Version:    int32(l.Uint32(buf[28:])),
+		ShapeType:  ShapeType(l.Uint32(buf[32:])),
+	}
+	f := func(off int) float64 { return math.Float64frombits(l.Uint64(buf[off:])) }
+	hdr.Xmin, hdr.Ymin, hdr.Xmax, hdr.Ymax = f(36), f(44), f(52), f(60)
+	hdr.Zmin, hdr.Zmax, hdr.Mmin, hdr.Mmax = f(68), f(76), f(84), f(92)
+	if hdr.Version != 1000 {
+		v.header(kind, "Version", 28, "is %d, must be 1000", hdr.Version)
+	}
+	if 2*int64(hdr.FileLength) != src.size() {
+		v.header(kind, "FileLength", 24, "is %d bytes, file is %d bytes",
+			2*int64(hdr.FileLength), src.size())
+	}
+	if hdr.ShapeType.String() == "UNKNOWN" {
+		v.header(kind, "ShapeType", 32, "unknown shape type %d", hdr.ShapeType)
+	}
+	return hdr, nil
+}
+
+// records walks the records of the .shp file.
+func (v *validator) records() error {
+	off := int64(100)
+	for i := 0; off < v.shp.size(); i++ {
+		if off+8 > v.shp.size() {
+			v.record(KindShp, i, off, "%d trailing bytes", v.shp.size()-off)
+			break
+		}
+		buf, err := v.shp.at(off, 8)
+		if err != nil {
+			return err
+		}
+		num := int32(b.Uint32(buf[0:]))
+		n := 2 * int64(b.Uint32(buf[4:]))
+		if num != int32(i+1) {
+			v.record(KindShp, i, off, "record number is %d, must be %d", num, i+1)
+		}
+		if n < 4 || off+8+n > v.shp.size() {
+			v.record(KindShp, i, off, "content length %d bytes does not fit in the file", n)
+			break
+		}
+		v.found = append(v.found, IndexEntry{Offset: off, Length: int(n)})
+		content, err := v.shp.at(off+8, int(n))
+		if err != nil {
+			return err
+		}
+		v.content(i, off, content)
+		off += 8 + n
+	}
+	return nil
+}
+
+// content checks the content of record i at off.
+func (v *validator) content(i int, off int64, content []byte) {
+	rv := RecordView{Number: int32(i + 1), Offset: off, Content: content}
+	t := rv.Type()
+	if t != NULL_SHAPE && t != v.hdr.ShapeType {
+		v.record(KindShp, i, off, "shape type %s in a %s file", t, v.hdr.ShapeType)
+	}
+	lo, ok := recordLayout(t, content)
+	if !ok {
+		v.record(KindShp, i, off, "content of %d bytes too short for a %s", len(content), t)
+		return
+	}
+	valid := false
+	for _, n := range lo.lengths {
+		valid = valid || n == len(content)
+	}
+	if !valid {
+		v.record(KindShp, i, off, "content length is %d bytes, must be one of %v for a %s",
+			len(content), lo.lengths, t)
+		return
+	}
+	if t == MULTI_PATCH {
+		return // not decoded by this package
+	}
+	if _, err := rv.Decode(); err != nil {
+		var rerr *RecordError
+		if errors.As(err, &rerr) {
+			err = rerr.Err
+		}
+		v.record(KindShp, i, off, "%v", err)
+		return
+	}
+	hdr := v.hdr
+	if bounds, ok := rv.Bounds(); ok && (bounds.Min.X < hdr.Xmin || bounds.Min.Y < hdr.Ymin ||
+		bounds.Max.X > hdr.Xmax || bounds.Max.Y > hdr.Ymax) {
+		v.record(KindShp, i, off, "bounds %v outside of the header bounds", bounds)
+	}
+	if min, max, ok := lo.zrange(content); ok && (min < hdr.Zmin || max > hdr.Zmax) {
+		v.record(KindShp, i, off, "Z range [%g, %g] outside of the header range", min, max)
+	}
+	if min, max, ok := lo.mrange(content); ok && min > noData && (min < hdr.Mmin || max > hdr.Mmax) {
+		v.record(KindShp, i, off, "M range [%g, %g] outside of the header range", min, max)
+	}
+}
+
+// noData is the bound below which M values mean "no data".
+const noData = -1e38
+
+// index checks the .shx file against the records of the .shp file.
+func (v *validator) index() error {
+	hdr, err := v.mainHeader(KindShx, v.shx)
+	if err != nil || hdr == nil {
+		return err
+	}
+	if hdr.ShapeType != v.hdr.ShapeType || hdr.Xmin != v.hdr.Xmin || hdr.Ymin != v.hdr.Ymin ||
+		hdr.Xmax != v.hdr.Xmax || hdr.Ymax != v.hdr.Ymax {
+		v.header(KindShx, "", 0, "differs from the .shp header")
+	}
+	if (v.shx.size()-100)%8 != 0 {
+		v.header(KindShx, "", 0, "%d trailing bytes", (v.shx.size()-100)%8)
+	}
+	n := int((v.shx.size() - 100) / 8)
+	if n != len(v.found) {
+		v.header(KindShx, "", 0, "has %d records, .shp file has %d", n, len(v.found))
+	}
+	for i := 0; i < n && i < len(v.found); i++ {
+		off := 100 + 8*int64(i)
+		buf, err := v.shx.at(off, 8)
+		if err != nil {
+			return err
+		}
+		if e := parseIndexEntry(buf); e != v.found[i] {
+			v.record(KindShx, i, off, "locates %d bytes at byte %d, record is %d bytes at byte %d",
+				e.Length, e.Offset, v.found[i].Length, v.found[i].Offset)
+		}
+	}
+	return nil
+}
+
+// table checks the .dbf file against the records of the .shp file.
+func (v *validator) table() error {
+	if v.dbf.size() < 32 {
+		v.header(KindDbf, "", 0, "file is %d bytes, too short for a header", v.dbf.size())
+		return nil
+	}
+	buf, err := v.dbf.at(0, 32)
+	if err != nil {
+		return err
+	}
+	lenHeader := int(l.Uint16(buf[8:]))
+	if buf, err = v.dbf.at(0, min(lenHeader, int(v.dbf.size()))); err != nil {
+		return err
+	}
+	dbf, err := OpenDBFFile(bytes.NewReader(buf))
+	if err != nil {
+		v.problems = append(v.problems, err)
+		return nil
+	}
+	h := dbf.DBFFileHeader
+	if int(h.NumRecords) != len(v.found) {
+		v.header(KindDbf, "NumRecords", 4, "is %d, .shp file has %d records",
+			h.NumRecords, len(v.found))
+	}
+	size := int64(h.LenHeader) + int64(h.NumRecords)*int64(h.LenRecord)
+	if got := v.dbf.size(); got != size && got != size+1 { // end of file marker
+		v.header(KindDbf, "", 0, "file is %d bytes, header gives %d", got, size)
+	}
+	return nil
+}
+
+// layout locates the parts of the content of a record that follow its
+// points.
+type layout struct {
+	z, m    int   // offsets of the Z and M ranges, or of the values of points, or -1
+	point   bool  // whether z and m locate single values
+	lengths []int // valid content lengths
+}
+
+// recordLayout returns the layout of content of type t. ok is false if
+// content is too short to hold the counts the layout depends on.
+func recordLayout(t ShapeType, content []byte) (lo layout, ok bool) {
+	lo.z, lo.m = -1, -1
+	count := func(off int) (int, bool) {
+		if len(content) < off+4 {
+			return 0, false
+		}
+		n := int(int32(l.Uint32(content[off:])))
+		return n, n >= 0
+	}
+	var base, n int // base is the length without Z or M values
+	switch t {
+	case NULL_SHAPE:
+		lo.lengths = []int{4}
+		return lo, true
+	case POINT:
+		lo.lengths = []int{20}
+		return lo, true
+	case POINT_M:
+		lo.point, lo.m, lo.lengths = true, 20, []int{28}
+		return lo, true
+	case POINT_Z:
+		lo.point, lo.z, lo.m, lo.lengths = true, 20, 28, []int{28, 36}
+		return lo, true
+	case MULTI_POINT, MULTI_POINT_M, MULTI_POINT_Z:
+		if n, ok = count(36); !ok {
+			return
+		}
+		base = 40 + 16*n
+	case POLY_LINE, POLY_LINE_M, POLY_LINE_Z, POLYGON, POLYGON_M, POLYGON_Z:
+		var np int
+		if np, ok = count(36); !ok {
+			return
+		}
+		if n, ok = count(40); !ok {
+			return
+		}
+		base = 44 + 4*np + 16*n
+	case MULTI_PATCH:
+		var np int
+		if np, ok = count(36); !ok {
+			return
+		}
+		if n, ok = count(40); !ok {
+			return
+		}
+		base = 44 + 8*np + 16*n
+	default:
+		return
+	}
+	values := 16 + 8*n // range and array of Z or M values
+	switch {
+	case t.hasZ():
+		// M values are optional
+		lo.z, lo.m, lo.lengths = base, base+values, []int{base + values, base + 2*values}
+	case t.hasM():
+		lo.m, lo.lengths = base, []int{base + values}
+	default:
+		lo.lengths = []int{base}
+	}
+	return lo, true
+}
+
+func (lo layout) zrange(content []byte) (min, max float64, ok bool) {
+	return lo.valueRange(content, lo.z)
+}
+
+func (lo layout) mrange(content []byte) (min, max float64, ok bool) {
+	return lo.valueRange(content, lo.m)
+}
+
+func (lo layout) valueRange(content []byte, off int) (min, max float64, ok bool) {
+	f := func(off int) float64 { return math.Float64frombits(l.Uint64(content[off:])) }
+	switch {
+	case off < 0:
+		return
+	case lo.point && off+8 <= len(content):
+		return f(off), f(off), true
+	case !lo.point && off+16 <= len(content):
+		return f(off), f(off + 8), true
+	}
+	return
+}
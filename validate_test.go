@@ -0,0 +1,134 @@
+package shapefile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+func section(data []byte) *io.SectionReader {
+	return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+}
+
+func TestValidate(t *testing.T) {
+	layer := &Layer{
+		Type:   POLYGON,
+		Fields: []FieldDescriptor{NewFieldDescriptor("ID", Number, 4, 0)},
+	}
+	for i := 0; i < 5; i++ {
+		layer.add(&ShapefileRecord{Geometry: square(float64(i), 0, 1)}, []interface{}{i})
+	}
+	shp, shx, dbf := new(memFile), new(memFile), new(memFile)
+	if err := layer.Write(shp, shx, dbf); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := Validate(section(shp.buf), section(shx.buf), section(dbf.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("problems in a valid file: %v", problems)
+	}
+
+	_, index, _ := ReadIndex(shx.reader())
+	b.PutUint32(shp.buf[index[1].Offset:], 7)         // record number
+	l.PutUint64(shp.buf[52:], l.Uint64(shp.buf[36:])) // Xmax = Xmin
+	l.PutUint32(dbf.buf[4:], 4)                       // NumRecords
+	shx.buf = shx.buf[:len(shx.buf)-8]                // last entry
+	shp.buf = append(shp.buf, 0, 0, 0)                // trailing bytes
+	problems, err = Validate(section(shp.buf), section(shx.buf), section(dbf.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shpHeader, shpRecord, shxHeader, dbfHeader int
+	for _, p := range problems {
+		var herr *HeaderError
+		var rerr *RecordError
+		switch {
+		case errors.As(p, &herr) && herr.Kind == KindShp:
+			shpHeader++
+		case errors.As(p, &herr) && herr.Kind == KindShx:
+			shxHeader++
+		case errors.As(p, &herr) && herr.Kind == KindDbf:
+			dbfHeader++
+		case errors.As(p, &rerr) && rerr.Kind == KindShp:
+			shpRecord++
+		default:
+			t.Errorf("unexpected problem: %v", p)
+		}
+	}
+	// shp: FileLength; record number, bounds of all five records,
+	// trailing bytes. shx: FileLength, header bounds, entry count. dbf:
+	// NumRecords, file size.
+	if shpHeader != 1 || shpRecord != 7 || shxHeader != 3 || dbfHeader != 2 {
+		t.Errorf("problems: %v", problems)
+	}
+}
+
+func TestValidateFiles(t *testing.T) {
+	problems, err := ValidateFiles(testBasename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("problems: %v", problems)
+	}
+}
+
+func TestValidateZWithoutM(t *testing.T) {
+	shp, shx := new(memFile), new(memFile)
+	w, err := NewShapefileWriter(shp, shx, POLYGON_Z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pg geom.PolygonZ
+	for _, r := range square(0, 0, 1).Rings {
+		var ring []geom.PointZ
+		for i, p := range r {
+			ring = append(ring, geom.PointZ{X: p.X, Y: p.Y, Z: float64(i % 4)})
+		}
+		pg.Rings = append(pg.Rings, ring)
+	}
+	if err = w.Write(pg); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// drop the M range and values from the end of the only record
+	n := 16 + 8*5
+	data := shp.buf[:len(shp.buf)-n]
+	b.PutUint32(data[24:], uint32(len(data)/2))
+	b.PutUint32(data[104:], b.Uint32(data[104:])-uint32(n/2))
+	b.PutUint32(shx.buf[104:], b.Uint32(shx.buf[104:])-uint32(n/2))
+
+	problems, err := Validate(section(data), section(shx.buf), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("problems: %v", problems)
+	}
+	s, err := OpenShapefile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := s.NextRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rec.Geometry.(geom.PolygonZM).Rings[0]
+	if len(got) != 5 || got[2].Z != 2 || got[2].M != missingM || rec.MRange != nil {
+		t.Errorf("got %v, M range %v", got, rec.MRange)
+	}
+	sh, err := decodeShape(data[108:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sh.Z) != 5 || sh.M != nil {
+		t.Errorf("shape has %d Z and %d M values", len(sh.Z), len(sh.M))
+	}
+}
@@ -0,0 +1,395 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/ctessum/geomop"
+	"github.com/twpayne/gogeom/geom"
+)
+
+// PolygonIssueKind identifies a polygon validity problem.
+type PolygonIssueKind int
+
+const (
+	RingNotClosed    PolygonIssueKind = iota // first and last points differ
+	RingTooShort                             // fewer than four points
+	RepeatedPoint                            // a point equal to the one before
+	SelfIntersection                         // two edges of a ring touch or cross
+	WrongOrientation                         // a ring winds the same way as the rings around it
+)
+
+func (k PolygonIssueKind) String() string {
+	switch k {
+	case RingNotClosed:
+		return "ring not closed"
+	case RingTooShort:
+		return "ring too short"
+	case RepeatedPoint:
+		return "repeated point"
+	case SelfIntersection:
+		return "self-intersection"
+	case WrongOrientation:
+		return "wrong orientation"
+	default:
+		return "unknown"
+	}
+}
+
+// PolygonIssue is a validity problem of a polygon ring.
+type PolygonIssue struct {
+	Kind  PolygonIssueKind
+	Ring  int        // index of the ring, counting the rings of all polygons
+	Point geom.Point // where the problem is
+}
+
+func (i PolygonIssue) String() string {
+	return fmt.Sprintf("ring %d: %s at (%g, %g)", i.Ring, i.Kind, i.Point.X, i.Point.Y)
+}
+
+// CheckPolygon reports the validity problems of the rings of a polygonal
+// geometry, in the XY plane. Outer rings must all wind the same way, and
+// holes the other way. It returns nil for other geometries.
+func CheckPolygon(g geom.T) (issues []PolygonIssue) {
+	if !isPolygonal(g) {
+		return nil
+	}
+	rings := geomParts(g)
+	for i, r := range rings {
+		if len(r) == 0 {
+			issues = append(issues, PolygonIssue{Kind: RingTooShort, Ring: i})
+			continue
+		}
+		for j := 1; j < len(r); j++ {
+			if r[j] == r[j-1] {
+				issues = append(issues, PolygonIssue{Kind: RepeatedPoint, Ring: i, Point: r[j]})
+			}
+		}
+		if r[0] != r[len(r)-1] {
+			issues = append(issues, PolygonIssue{Kind: RingNotClosed, Ring: i, Point: r[len(r)-1]})
+		}
+		clean := pick(r, ringPlan(r))
+		if clean == nil {
+			issues = append(issues, PolygonIssue{Kind: RingTooShort, Ring: i, Point: r[0]})
+			continue
+		}
+		for _, p := range ringIntersections(clean) {
+			issues = append(issues, PolygonIssue{Kind: SelfIntersection, Ring: i, Point: p})
+		}
+	}
+	// the first outer ring sets the direction
+	ref := 0
+	for i, r := range rings {
+		if len(r) > 0 && signedArea(r) != 0 && !ringIsHole(rings, i) {
+			ref = i + 1
+			if signedArea(r) < 0 {
+				ref = -ref
+			}
+			break
+		}
+	}
+	if ref == 0 {
+		return
+	}
+	for i, r := range rings {
+		a := signedArea(r)
+		if a != 0 && (a > 0) != (ref > 0) != ringIsHole(rings, i) {
+			issues = append(issues, PolygonIssue{Kind: WrongOrientation, Ring: i, Point: r[0]})
+		}
+	}
+	return
+}
+
+// PolygonReport lists the validity problems of a record.
+type PolygonReport struct {
+	Record int // index in Layer.Records
+	Issues []PolygonIssue
+}
+
+// CheckPolygons checks the geometries of the records of layer with
+// CheckPolygon, and reports the records that have problems.
+func (layer *Layer) CheckPolygons() (reports []PolygonReport) {
+	for i, rec := range layer.Records {
+		if issues := CheckPolygon(rec.Geometry); len(issues) > 0 {
+			reports = append(reports, PolygonReport{Record: i, Issues: issues})
+		}
+	}
+	return
+}
+
+// RepairPolygon fixes the problems CheckPolygon reports in g, which is
+// not modified. It removes repeated points, closes rings, drops rings
+// that are left with fewer than four points, and orients outer rings
+// clockwise and holes counter-clockwise, as in the shapefile format.
+// For POLYGON geometries, self-intersecting rings are split into simple
+// ones, and the result is built with geomop, so it may be a
+// MultiPolygon. Self-intersections of polygons with Z or M values are
+// left as they are. Other geometries are returned unchanged.
+func RepairPolygon(g geom.T) (geom.T, error) {
+	if !isPolygonal(g) {
+		return g, nil
+	}
+	xy := geomParts(g)
+	plans := make([][]int, len(xy))
+	var kept [][]geom.Point
+	var keptIdx []int
+	for i, r := range xy {
+		if plans[i] = ringPlan(r); plans[i] != nil {
+			kept = append(kept, pick(r, plans[i]))
+			keptIdx = append(keptIdx, i)
+		}
+	}
+	for k, reverse := range esriReverse(kept) {
+		if reverse {
+			p := plans[keptIdx[k]]
+			for a, b := 0, len(p)-1; a < b; a, b = a+1, b-1 {
+				p[a], p[b] = p[b], p[a]
+			}
+			kept[k] = pick(xy[keptIdx[k]], p)
+		}
+	}
+
+	switch t := g.(type) {
+	case geom.Polygon:
+		return splitSelfIntersections(kept)
+	case geom.MultiPolygon:
+		return splitSelfIntersections(kept)
+	case geom.PolygonZ:
+		return geom.PolygonZ{Rings: pickRings(t.Rings, plans)}, nil
+	case geom.PolygonM:
+		return geom.PolygonM{Rings: pickRings(t.Rings, plans)}, nil
+	case geom.PolygonZM:
+		return geom.PolygonZM{Rings: pickRings(t.Rings, plans)}, nil
+	}
+	return g, nil
+}
+
+// RepairPolygons replaces the geometry of every record of layer with
+// the result of RepairPolygon.
+func (layer *Layer) RepairPolygons() error {
+	for i, rec := range layer.Records {
+		g, err := RepairPolygon(rec.Geometry)
+		if err != nil {
+			return fmt.Errorf("record %d: %v", i+1, err)
+		}
+		rec.Geometry = g
+		rec.Bounds = geomBounds(g)
+	}
+	return nil
+}
+
+// ringPlan returns the indices of the points of ring that remain after
+// removing repeated points and closing it, or nil if fewer than four
+// points remain.
+func ringPlan(ring []geom.Point) []int {
+	plan := make([]int, 0, len(ring)+1)
+	for i, p := range ring {
+		if len(plan) == 0 || p != ring[plan[len(plan)-1]] {
+			plan = append(plan, i)
+		}
+	}
+	if len(plan) > 1 && ring[plan[0]] == ring[plan[len(plan)-1]] {
+		plan = plan[:len(plan)-1]
+	}
+	if len(plan) < 3 {
+		return nil
+	}
+	return append(plan, plan[0])
+}
+
+func pick[P any](ring []P, plan []int) []P {
+	if plan == nil {
+		return nil
+	}
+	out := make([]P, len(plan))
+	for i, j := range plan {
+		out[i] = ring[j]
+	}
+	return out
+}
+
+func pickRings[P any](rings [][]P, plans [][]int) (out [][]P) {
+	for i, r := range rings {
+		if plans[i] != nil {
+			out = append(out, pick(r, plans[i]))
+		}
+	}
+	return
+}
+
+// ringCrossing is a point where two edges of a ring touch.
+type ringCrossing struct {
+	i, j int // edges, i < j
+	p    geom.Point
+}
+
+// ringCrossings returns the points where non-adjacent edges of the closed
+// ring touch.
+func ringCrossings(ring []geom.Point) (crossings []ringCrossing) {
+	n := len(ring) - 1 // number of edges
+	bounds := make([]*geom.Bounds, n)
+	for i := 0; i < n; i++ {
+		a, b := ring[i], ring[i+1]
+		bounds[i] = &geom.Bounds{
+			Min: geom.Point{X: math.Min(a.X, b.X), Y: math.Min(a.Y, b.Y)},
+			Max: geom.Point{X: math.Max(a.X, b.X), Y: math.Max(a.Y, b.Y)},
+		}
+	}
+	idx := newGridIndex(bounds)
+	for i := 0; i < n; i++ {
+		idx.query(bounds[i], func(j int) {
+			if j <= i+1 || (i == 0 && j == n-1) {
+				return // same or adjacent edges
+			}
+			a, b, c, d := ring[i], ring[i+1], ring[j], ring[j+1]
+			if segmentsCross(a, b, c, d) {
+				crossings = append(crossings, ringCrossing{i: i, j: j, p: intersection(a, b, c, d)})
+			}
+		})
+	}
+	return
+}
+
+// ringIntersections returns the points where a closed ring touches or
+// crosses itself.
+func ringIntersections(ring []geom.Point) []geom.Point {
+	var points []geom.Point
+	for _, c := range ringCrossings(ring) {
+		points = append(points, c.p)
+	}
+	return points
+}
+
+// intersection returns a point where segments ab and cd, which touch,
+// meet. For overlapping collinear segments, it returns an endpoint in the
+// overlap.
+func intersection(a, b, c, d geom.Point) geom.Point {
+	d1, d2 := cross(c, d, a), cross(c, d, b)
+	if d1 != d2 {
+		t := d1 / (d1 - d2)
+		switch t {
+		case 0:
+			return a
+		case 1:
+			return b
+		}
+		return geom.Point{X: a.X + t*(b.X-a.X), Y: a.Y + t*(b.Y-a.Y)}
+	}
+	for _, p := range []geom.Point{c, d} {
+		if onSegment(p, a, b) {
+			return p
+		}
+	}
+	return a
+}
+
+// splitRing splits a closed ring at the points where it touches itself
+// into closed rings that do not.
+func splitRing(ring []geom.Point) (loops [][]geom.Point) {
+	crossings := ringCrossings(ring)
+	if len(crossings) == 0 {
+		return [][]geom.Point{ring}
+	}
+	// insert the crossing points into the edges they lie on
+	extra := make(map[int][]geom.Point)
+	for _, c := range crossings {
+		extra[c.i] = append(extra[c.i], c.p)
+		extra[c.j] = append(extra[c.j], c.p)
+	}
+	var pts []geom.Point
+	for i := 0; i < len(ring)-1; i++ {
+		a := ring[i]
+		pts = append(pts, a)
+		e := extra[i]
+		sort.Slice(e, func(x, y int) bool {
+			return math.Hypot(e[x].X-a.X, e[x].Y-a.Y) < math.Hypot(e[y].X-a.X, e[y].Y-a.Y)
+		})
+		for _, p := range e {
+			if p != pts[len(pts)-1] && p != ring[i+1] {
+				pts = append(pts, p)
+			}
+		}
+	}
+	pts = append(pts, ring[0])
+
+	// walk the ring, cutting off a loop whenever a point comes back
+	var path []geom.Point
+	pos := make(map[geom.Point]int)
+	for _, p := range pts {
+		if k, ok := pos[p]; ok {
+			loop := append(append([]geom.Point(nil), path[k:]...), p)
+			if len(loop) >= 4 && signedArea(loop) != 0 {
+				loops = append(loops, loop)
+			}
+			for _, q := range path[k+1:] {
+				delete(pos, q)
+			}
+			path = path[:k+1]
+			continue
+		}
+		pos[p] = len(path)
+		path = append(path, p)
+	}
+	return
+}
+
+// splitSelfIntersections builds a polygon from rings, splitting the
+// self-intersecting ones. Without self-intersections, rings are returned
+// as a polygon as they are.
+func splitSelfIntersections(rings [][]geom.Point) (geom.T, error) {
+	split := false
+	for _, r := range rings {
+		if len(ringCrossings(r)) > 0 {
+			split = true
+			break
+		}
+	}
+	if !split {
+		return geom.Polygon{Rings: rings}, nil
+	}
+	var shells, holes geom.T
+	for i, r := range rings {
+		hole := ringIsHole(rings, i)
+		for _, loop := range splitRing(r) {
+			if signedArea(loop) > 0 {
+				// outer loops clockwise, so that geomop sees areas
+				reversed := make([]geom.Point, len(loop))
+				for k, p := range loop {
+					reversed[len(loop)-1-k] = p
+				}
+				loop = reversed
+			}
+			var err error
+			pg := geom.Polygon{Rings: [][]geom.Point{loop}}
+			if hole {
+				holes, err = union(holes, pg)
+			} else {
+				shells, err = union(shells, pg)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if shells == nil {
+		return geom.Polygon{}, nil
+	}
+	g := shells
+	if holes != nil {
+		var err error
+		if g, err = geomop.Construct(shells, holes, geomop.DIFFERENCE); err != nil {
+			return nil, err
+		}
+	}
+	// geomop does not follow the orientation of the shapefile format
+	orientRings(g, ClockwiseExterior)
+	return g, nil
+}
+
+func union(a, b geom.T) (geom.T, error) {
+	if a == nil {
+		return b, nil
+	}
+	return geomop.Construct(a, b, geomop.UNION)
+}
@@ -0,0 +1,121 @@
+package shapefile
+
+import (
+	"testing"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+func TestCheckPolygon(t *testing.T) {
+	bowtie := [][]geom.Point{{{X: 0, Y: 0}, {X: 2, Y: 2}, {X: 2, Y: 0}, {X: 0, Y: 2}, {X: 0, Y: 0}}}
+	hole := square(1, 1, 1).Rings[0] // counter-clockwise, like the outer ring
+	tests := []struct {
+		name string
+		g    geom.T
+		want []PolygonIssue
+	}{
+		{"valid", square(0, 0, 1), nil},
+		{"not closed", geom.Polygon{Rings: [][]geom.Point{{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 1}}}},
+			[]PolygonIssue{{Kind: RingNotClosed, Point: geom.Point{X: 0, Y: 1}}}},
+		{"repeated", geom.Polygon{Rings: [][]geom.Point{{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 0}, {X: 1, Y: 1}, {X: 0, Y: 0}}}},
+			[]PolygonIssue{{Kind: RepeatedPoint, Point: geom.Point{X: 1, Y: 0}}}},
+		{"too short", geom.Polygon{Rings: [][]geom.Point{{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 0}}}},
+			[]PolygonIssue{{Kind: RingTooShort, Point: geom.Point{X: 0, Y: 0}}}},
+		{"bowtie", geom.Polygon{Rings: bowtie},
+			[]PolygonIssue{{Kind: SelfIntersection, Point: geom.Point{X: 1, Y: 1}}}},
+		{"hole orientation", geom.Polygon{Rings: [][]geom.Point{square(0, 0, 3).Rings[0], hole}},
+			[]PolygonIssue{{Kind: WrongOrientation, Ring: 1, Point: hole[0]}}},
+	}
+	for _, test := range tests {
+		got := CheckPolygon(test.g)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v, want %v", test.name, got[i], test.want[i])
+			}
+		}
+	}
+}
+
+func TestRepairPolygon(t *testing.T) {
+	g := geom.Polygon{Rings: [][]geom.Point{
+		{{X: 0, Y: 0}, {X: 3, Y: 0}, {X: 3, Y: 0}, {X: 3, Y: 3}, {X: 0, Y: 3}},
+		square(1, 1, 1).Rings[0],
+		{{X: 5, Y: 5}, {X: 6, Y: 5}, {X: 5, Y: 5}},
+	}}
+	r, err := RepairPolygon(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := r.(geom.Polygon)
+	if len(p.Rings) != 2 {
+		t.Fatalf("got %d rings, want 2", len(p.Rings))
+	}
+	if issues := CheckPolygon(p); len(issues) != 0 {
+		t.Errorf("issues after repair: %v", issues)
+	}
+	if signedArea(p.Rings[0]) >= 0 || signedArea(p.Rings[1]) <= 0 {
+		t.Errorf("rings not oriented clockwise outside and counter-clockwise inside: %v", p.Rings)
+	}
+	if len(g.Rings[0]) != 5 {
+		t.Errorf("input modified")
+	}
+
+	z := geom.PolygonZ{Rings: [][]geom.PointZ{{{X: 0, Y: 0, Z: 1}, {X: 0, Y: 1, Z: 2}, {X: 0, Y: 1, Z: 2}, {X: 1, Y: 1, Z: 3}, {X: 1, Y: 0, Z: 4}}}}
+	r, err = RepairPolygon(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []geom.PointZ{{X: 0, Y: 0, Z: 1}, {X: 0, Y: 1, Z: 2}, {X: 1, Y: 1, Z: 3}, {X: 1, Y: 0, Z: 4}, {X: 0, Y: 0, Z: 1}}
+	if got := r.(geom.PolygonZ).Rings[0]; len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	} else {
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("got %v, want %v", got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestRepairPolygonBowtie(t *testing.T) {
+	bowtie := []geom.Point{{X: 0, Y: 0}, {X: 4, Y: 4}, {X: 4, Y: 0}, {X: 0, Y: 4}, {X: 0, Y: 0}}
+	hole := []geom.Point{{X: 3.2, Y: 1.5}, {X: 3.6, Y: 2}, {X: 3.2, Y: 2.5}, {X: 3.2, Y: 1.5}}
+	for _, rings := range [][][]geom.Point{{bowtie}, {bowtie, hole}} {
+		r, err := RepairPolygon(geom.Polygon{Rings: rings})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := geomParts(r)
+		if len(got) != len(rings)+1 {
+			t.Fatalf("got %d rings, want %d: %v", len(got), len(rings)+1, got)
+		}
+		for i, ring := range got {
+			if hole := ringIsHole(got, i); hole != (signedArea(ring) > 0) {
+				t.Errorf("ring %v (hole %v) is not oriented clockwise outside and counter-clockwise inside", ring, hole)
+			}
+		}
+		if issues := CheckPolygon(r); len(issues) != 0 {
+			t.Errorf("issues after repair: %v", issues)
+		}
+	}
+}
+
+func TestSplitRing(t *testing.T) {
+	loops := splitRing([]geom.Point{{X: 0, Y: 0}, {X: 2, Y: 2}, {X: 2, Y: 0}, {X: 0, Y: 2}, {X: 0, Y: 0}})
+	if len(loops) != 2 {
+		t.Fatalf("got %d loops, want 2: %v", len(loops), loops)
+	}
+	for _, loop := range loops {
+		if len(ringCrossings(loop)) != 0 || len(loop) != 4 {
+			t.Errorf("loop %v is not a simple triangle", loop)
+		}
+		if a := signedArea(loop); a != 1 && a != -1 {
+			t.Errorf("loop %v has area %g", loop, a)
+		}
+	}
+}
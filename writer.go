@@ -0,0 +1,477 @@
+package shapefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// shapeData is the on-disk layout of a record: parts index into
+// points, and z and m (if present) run parallel to points.
+type shapeData struct {
+	typ    ShapeType
+	parts  []int32
+	points []geom.Point
+	z, m   []float64
+}
+
+// baseType returns the 2D shape type corresponding to t.
+func (t ShapeType) baseType() ShapeType {
+	switch t {
+	case POINT_Z, POINT_M:
+		return POINT
+	case POLY_LINE_Z, POLY_LINE_M:
+		return POLY_LINE
+	case POLYGON_Z, POLYGON_M:
+		return POLYGON
+	case MULTI_POINT_Z, MULTI_POINT_M:
+		return MULTI_POINT
+	}
+	return t
+}
+
+// hasZ reports whether records of type t carry Z values.
+func (t ShapeType) hasZ() bool {
+	switch t {
+	case POINT_Z, POLY_LINE_Z, POLYGON_Z, MULTI_POINT_Z, MULTI_PATCH:
+		return true
+	}
+	return false
+}
+
+// hasM reports whether records of type t carry M values.
+func (t ShapeType) hasM() bool {
+	return t.hasZ() || t == POINT_M || t == POLY_LINE_M ||
+		t == POLYGON_M || t == MULTI_POINT_M
+}
+
+func (d *shapeData) addPart() {
+	d.parts = append(d.parts, int32(len(d.points)))
+}
+
+func (d *shapeData) add(x, y, z, m float64) {
+	d.points = append(d.points, geom.Point{X: x, Y: y})
+	d.z = append(d.z, z)
+	d.m = append(d.m, m)
+}
+
+// addRing appends a polygon ring, reversing it if asked to.
+func (d *shapeData) addRing(n int, reverse bool, at func(i int) (x, y, z, m float64)) {
+	d.addPart()
+	for i := 0; i < n; i++ {
+		if reverse {
+			d.add(at(n - 1 - i))
+		} else {
+			d.add(at(i))
+		}
+	}
+}
+
+func (d *shapeData) addLine(n int, at func(i int) (x, y, z, m float64)) {
+	d.addPart()
+	for i := 0; i < n; i++ {
+		d.add(at(i))
+	}
+}
+
+// newShapeData converts g into its shapefile layout, orienting the
+// rings of polygons following o.
+func newShapeData(g geom.T, o Orientation) (*shapeData, error) {
+	d := new(shapeData)
+	var reverse []bool
+	if isPolygonal(g) {
+		reverse = ringReverse(g, o, true)
+	}
+	switch t := g.(type) {
+	case nil:
+		d.typ = NULL_SHAPE
+	case geom.Point:
+		d.typ = POINT
+		d.add(t.X, t.Y, 0, 0)
+	case geom.PointM:
+		d.typ = POINT_M
+		d.add(t.X, t.Y, 0, t.M)
+	case *geom.PointM:
+		d.typ = POINT_M
+		d.add(t.X, t.Y, 0, t.M)
+	case geom.PointZ:
+		d.typ = POINT_Z
+		d.add(t.X, t.Y, t.Z, 0)
+	case geom.PointZM:
+		d.typ = POINT_Z
+		d.add(t.X, t.Y, t.Z, t.M)
+	case geom.MultiPoint:
+		d.typ = MULTI_POINT
+		for _, p := range t.Points {
+			d.add(p.X, p.Y, 0, 0)
+		}
+	case geom.MultiPointM:
+		d.typ = MULTI_POINT_M
+		for _, p := range t.Points {
+			d.add(p.X, p.Y, 0, p.M)
+		}
+	case geom.MultiPointZ:
+		d.typ = MULTI_POINT_Z
+		for _, p := range t.Points {
+			d.add(p.X, p.Y, p.Z, 0)
+		}
+	case geom.MultiPointZM:
+		d.typ = MULTI_POINT_Z
+		for _, p := range t.Points {
+			d.add(p.X, p.Y, p.Z, p.M)
+		}
+	case geom.LineString:
+		d.typ = POLY_LINE
+		d.addLine(len(t.Points), func(i int) (x, y, z, m float64) {
+			return t.Points[i].X, t.Points[i].Y, 0, 0
+		})
+	case geom.MultiLineString:
+		d.typ = POLY_LINE
+		for _, ls := range t.LineStrings {
+			d.addLine(len(ls.Points), func(i int) (x, y, z, m float64) {
+				return ls.Points[i].X, ls.Points[i].Y, 0, 0
+			})
+		}
+	case geom.MultiLineStringM:
+		d.typ = POLY_LINE_M
+		for _, ls := range t.LineStrings {
+			d.addLine(len(ls.Points), func(i int) (x, y, z, m float64) {
+				p := ls.Points[i]
+				return p.X, p.Y, 0, p.M
+			})
+		}
+	case geom.MultiLineStringZ:
+		d.typ = POLY_LINE_Z
+		for _, ls := range t.LineStrings {
+			d.addLine(len(ls.Points), func(i int) (x, y, z, m float64) {
+				p := ls.Points[i]
+				return p.X, p.Y, p.Z, 0
+			})
+		}
+	case geom.MultiLineStringZM:
+		d.typ = POLY_LINE_Z
+		for _, ls := range t.LineStrings {
+			d.addLine(len(ls.Points), func(i int) (x, y, z, m float64) {
+				p := ls.Points[i]
+				return p.X, p.Y, p.Z, p.M
+			})
+		}
+	case geom.Polygon:
+		d.typ = POLYGON
+		for i, r := range t.Rings {
+			d.addRing(len(r), reverse[i], func(i int) (x, y, z, m float64) {
+				return r[i].X, r[i].Y, 0, 0
+			})
+		}
+	case geom.MultiPolygon:
+		d.typ = POLYGON
+		for _, pg := range t.Polygons {
+			for _, r := range pg.Rings {
+				d.addRing(len(r), reverse[len(d.parts)], func(i int) (x, y, z, m float64) {
+					return r[i].X, r[i].Y, 0, 0
+				})
+			}
+		}
+	case geom.PolygonM:
+		d.typ = POLYGON_M
+		for i, r := range t.Rings {
+			d.addRing(len(r), reverse[i], func(i int) (x, y, z, m float64) {
+				return r[i].X, r[i].Y, 0, r[i].M
+			})
+		}
+	case geom.PolygonZ:
+		d.typ = POLYGON_Z
+		for i, r := range t.Rings {
+			d.addRing(len(r), reverse[i], func(i int) (x, y, z, m float64) {
+				return r[i].X, r[i].Y, r[i].Z, 0
+			})
+		}
+	case geom.PolygonZM:
+		d.typ = POLYGON_Z
+		for i, r := range t.Rings {
+			d.addRing(len(r), reverse[i], func(i int) (x, y, z, m float64) {
+				return r[i].X, r[i].Y, r[i].Z, r[i].M
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type: %T", g)
+	}
+	return d, nil
+}
+
+// contentLength returns the length in bytes of the record content for
+// d written as type t.
+func (d *shapeData) contentLength(t ShapeType) int {
+	n := len(d.points)
+	switch t.baseType() {
+	case NULL_SHAPE:
+		return 4
+	case POINT:
+		switch {
+		case t.hasZ():
+			return 36
+		case t.hasM():
+			return 28
+		}
+		return 20
+	case MULTI_POINT:
+		size := 40 + 16*n
+		if t.hasZ() {
+			size += 16 + 8*n
+		}
+		if t.hasM() {
+			size += 16 + 8*n
+		}
+		return size
+	}
+	size := 44 + 4*len(d.parts) + 16*n
+	if t.hasZ() {
+		size += 16 + 8*n
+	}
+	if t.hasM() {
+		size += 16 + 8*n
+	}
+	return size
+}
+
+func appendInt32(buf []byte, v int32) []byte {
+	return l.AppendUint32(buf, uint32(v))
+}
+
+func appendFloat64(buf []byte, v float64) []byte {
+	return l.AppendUint64(buf, math.Float64bits(v))
+}
+
+func appendRange(buf []byte, v []float64) []byte {
+	lo, hi := 0., 0.
+	for i, x := range v {
+		if i == 0 || x < lo {
+			lo = x
+		}
+		if i == 0 || x > hi {
+			hi = x
+		}
+	}
+	buf = appendFloat64(buf, lo)
+	buf = appendFloat64(buf, hi)
+	for _, x := range v {
+		buf = appendFloat64(buf, x)
+	}
+	return buf
+}
+
+// bounds returns the XY extent of d.
+func (d *shapeData) bounds() *geom.Bounds {
+	if len(d.points) == 0 {
+		return nil
+	}
+	bb := &geom.Bounds{Min: d.points[0], Max: d.points[0]}
+	for _, p := range d.points[1:] {
+		bb.Min.X = math.Min(bb.Min.X, p.X)
+		bb.Min.Y = math.Min(bb.Min.Y, p.Y)
+		bb.Max.X = math.Max(bb.Max.X, p.X)
+		bb.Max.Y = math.Max(bb.Max.Y, p.Y)
+	}
+	return bb
+}
+
+// appendContent appends the record content of d, written as type t,
+// to buf.
+func (d *shapeData) appendContent(buf []byte, t ShapeType) []byte {
+	buf = appendInt32(buf, int32(t))
+	switch t.baseType() {
+	case NULL_SHAPE:
+		return buf
+	case POINT:
+		buf = appendFloat64(buf, d.points[0].X)
+		buf = appendFloat64(buf, d.points[0].Y)
+		if t.hasZ() {
+			buf = appendFloat64(buf, d.z[0])
+		}
+		if t.hasM() {
+			buf = appendFloat64(buf, d.m[0])
+		}
+		return buf
+	}
+	bb := d.bounds()
+	if bb == nil {
+		bb = new(geom.Bounds)
+	}
+	buf = appendFloat64(buf, bb.Min.X)
+	buf = appendFloat64(buf, bb.Min.Y)
+	buf = appendFloat64(buf, bb.Max.X)
+	buf = appendFloat64(buf, bb.Max.Y)
+	if t.baseType() != MULTI_POINT {
+		buf = appendInt32(buf, int32(len(d.parts)))
+	}
+	buf = appendInt32(buf, int32(len(d.points)))
+	if t.baseType() != MULTI_POINT {
+		for _, p := range d.parts {
+			buf = appendInt32(buf, p)
+		}
+	}
+	for _, p := range d.points {
+		buf = appendFloat64(buf, p.X)
+		buf = appendFloat64(buf, p.Y)
+	}
+	if t.hasZ() {
+		buf = appendRange(buf, d.z)
+	}
+	if t.hasM() {
+		buf = appendRange(buf, d.m)
+	}
+	return buf
+}
+
+// writeShapefileHeader writes the 100 byte header shared by .shp and
+// .shx files.
+func writeShapefileHeader(w io.Writer, h *ShapefileHeader) error {
+	buf := make([]byte, 0, 100)
+	buf = b.AppendUint32(buf, 9994)
+	buf = append(buf, make([]byte, 20)...)
+	buf = b.AppendUint32(buf, uint32(h.FileLength))
+	buf = appendInt32(buf, h.Version)
+	buf = appendInt32(buf, int32(h.ShapeType))
+	for _, v := range []float64{h.Xmin, h.Ymin, h.Xmax, h.Ymax,
+		h.Zmin, h.Zmax, h.Mmin, h.Mmax} {
+		buf = appendFloat64(buf, v)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// ShapefileWriter writes geometries to a .shp file and its .shx index.
+// Records are streamed as they are written; the file headers are filled
+// in by Close.
+type ShapefileWriter struct {
+	Header *ShapefileHeader
+	shp    io.WriteSeeker
+	shx    io.WriteSeeker
+	shpBuf *bufio.Writer
+	shxBuf *bufio.Writer
+	n      int32 // number of records written
+	buf    []byte
+	empty  bool // no bounds seen yet
+
+	orientation Orientation
+}
+
+// NewShapefileWriter creates a writer for records of type t. shx may be
+// nil if no index is wanted.
+func NewShapefileWriter(shp, shx io.WriteSeeker, t ShapeType) (w *ShapefileWriter, err error) {
+	w = &ShapefileWriter{shp: shp, shx: shx, empty: true}
+	w.Header = &ShapefileHeader{FileLength: 50, Version: 1000, ShapeType: t}
+	w.shpBuf = bufio.NewWriter(shp)
+	if err = writeShapefileHeader(w.shpBuf, w.Header); err != nil {
+		return nil, err
+	}
+	if shx != nil {
+		w.shxBuf = bufio.NewWriter(shx)
+		if err = writeShapefileHeader(w.shxBuf, w.Header); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// SetOrientation sets how the rings of polygons are oriented as they are
+// written. It defaults to DefaultOrientation, which orients them as the
+// shapefile specification requires.
+func (w *ShapefileWriter) SetOrientation(o Orientation) {
+	w.orientation = o
+}
+
+// Write appends g as the next record. g must be nil or match the shape
+// type of the file; missing Z and M values are written as zero.
+func (w *ShapefileWriter) Write(g geom.T) error {
+	d, err := newShapeData(g, w.orientation)
+	if err != nil {
+		return err
+	}
+	return w.writeShapeData(d)
+}
+
+func (w *ShapefileWriter) writeShapeData(d *shapeData) error {
+	t := w.Header.ShapeType
+	if d.typ != NULL_SHAPE && d.typ.baseType() != t.baseType() {
+		return fmt.Errorf("cannot write %s record to %s file", d.typ, t)
+	} else if d.typ == NULL_SHAPE {
+		t = NULL_SHAPE
+	}
+	if len(d.z) < len(d.points) {
+		d.z = make([]float64, len(d.points))
+	}
+	if len(d.m) < len(d.points) {
+		d.m = make([]float64, len(d.points))
+	}
+	w.n++
+	length := int32(d.contentLength(t) / 2)
+	offset := w.Header.FileLength
+	w.buf = b.AppendUint32(w.buf[:0], uint32(w.n))
+	w.buf = b.AppendUint32(w.buf, uint32(length))
+	w.buf = d.appendContent(w.buf, t)
+	if _, err := w.shpBuf.Write(w.buf); err != nil {
+		return err
+	}
+	if w.shxBuf != nil {
+		w.buf = b.AppendUint32(w.buf[:0], uint32(offset))
+		w.buf = b.AppendUint32(w.buf, uint32(length))
+		if _, err := w.shxBuf.Write(w.buf); err != nil {
+			return err
+		}
+	}
+	w.Header.FileLength += 4 + length
+	w.extend(d)
+	return nil
+}
+
+// extend grows the header bounds to include d.
+func (w *ShapefileWriter) extend(d *shapeData) {
+	h := w.Header
+	for i, p := range d.points {
+		if w.empty {
+			h.Xmin, h.Xmax, h.Ymin, h.Ymax = p.X, p.X, p.Y, p.Y
+			h.Zmin, h.Zmax, h.Mmin, h.Mmax = d.z[i], d.z[i], d.m[i], d.m[i]
+			w.empty = false
+			continue
+		}
+		h.Xmin, h.Xmax = math.Min(h.Xmin, p.X), math.Max(h.Xmax, p.X)
+		h.Ymin, h.Ymax = math.Min(h.Ymin, p.Y), math.Max(h.Ymax, p.Y)
+		h.Zmin, h.Zmax = math.Min(h.Zmin, d.z[i]), math.Max(h.Zmax, d.z[i])
+		h.Mmin, h.Mmax = math.Min(h.Mmin, d.m[i]), math.Max(h.Mmax, d.m[i])
+	}
+}
+
+// Close flushes the remaining records and writes the final file
+// headers. It does not close the underlying writers.
+func (w *ShapefileWriter) Close() error {
+	if err := w.shpBuf.Flush(); err != nil {
+		return err
+	}
+	if err := rewriteHeader(w.shp, w.Header); err != nil {
+		return err
+	}
+	if w.shxBuf == nil {
+		return nil
+	}
+	if err := w.shxBuf.Flush(); err != nil {
+		return err
+	}
+	shxHeader := *w.Header
+	shxHeader.FileLength = 50 + 4*w.n
+	return rewriteHeader(w.shx, &shxHeader)
+}
+
+func rewriteHeader(w io.WriteSeeker, h *ShapefileHeader) error {
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := writeShapefileHeader(w, h); err != nil {
+		return err
+	}
+	_, err := w.Seek(0, io.SeekEnd)
+	return err
+}
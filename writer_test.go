@@ -0,0 +1,150 @@
+package shapefile
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/twpayne/gogeom/geom"
+)
+
+// memFile is an in-memory io.WriteSeeker.
+type memFile struct {
+	buf []byte
+	pos int
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if need := f.pos + len(p); need > len(f.buf) {
+		f.buf = append(f.buf, make([]byte, need-len(f.buf))...)
+	}
+	copy(f.buf[f.pos:], p)
+	f.pos += len(p)
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		f.pos = int(offset)
+	case io.SeekCurrent:
+		f.pos += int(offset)
+	case io.SeekEnd:
+		f.pos = len(f.buf) + int(offset)
+	}
+	return int64(f.pos), nil
+}
+
+func (f *memFile) reader() *bytes.Reader { return bytes.NewReader(f.buf) }
+
+func square(x, y, size float64) geom.Polygon {
+	return geom.Polygon{Rings: [][]geom.Point{{
+		{X: x, Y: y}, {X: x + size, Y: y}, {X: x + size, Y: y + size},
+		{X: x, Y: y + size}, {X: x, Y: y},
+	}}}
+}
+
+// writeTestLayer writes layer and reads it back.
+func writeTestLayer(t *testing.T, layer *Layer) *Layer {
+	shp, shx, dbf := new(memFile), new(memFile), new(memFile)
+	if err := layer.Write(shp, shx, dbf); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenShapefile(shp.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := OpenDBFFile(dbf.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ReadLayer(s, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shx.buf) != 100+8*len(layer.Records) {
+		t.Errorf("shx length %d", len(shx.buf))
+	}
+	return out
+}
+
+func TestWriteLayer(t *testing.T) {
+	layer := &Layer{
+		Type: POLYGON,
+		Fields: []FieldDescriptor{
+			NewFieldDescriptor("NAME", Character, 8, 0),
+			NewFieldDescriptor("POP", Number, 10, 0),
+			NewFieldDescriptor("DENSITY", Number, 12, 3),
+		},
+	}
+	layer.add(&ShapefileRecord{Geometry: square(0, 0, 1)},
+		[]interface{}{"a", 10, 1.5})
+	layer.add(&ShapefileRecord{Geometry: square(2, 0, 2)},
+		[]interface{}{"b", 20, 0.25})
+
+	out := writeTestLayer(t, layer)
+	if len(out.Records) != 2 {
+		t.Fatalf("read %d records", len(out.Records))
+	}
+	if out.Rows[1][0] != "b" || out.Rows[1][1] != 20 || out.Rows[1][2] != 0.25 {
+		t.Errorf("unexpected row: %v", out.Rows[1])
+	}
+	b := out.Records[1].Bounds
+	if b.Min.X != 2 || b.Max.X != 4 || b.Max.Y != 2 {
+		t.Errorf("unexpected bounds: %v", b)
+	}
+	pg := out.Records[0].Geometry.(geom.Polygon)
+	if len(pg.Rings[0]) != 5 || math.Abs(signedArea(pg.Rings[0])) != 1 {
+		t.Errorf("unexpected ring: %v", pg.Rings[0])
+	}
+}
+
+func TestDBFWriterValues(t *testing.T) {
+	day := time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)
+	f := new(memFile)
+	w, err := NewDBFWriter(f, []FieldDescriptor{
+		NewFieldDescriptor("NAME", Character, 4, 0),
+		NewFieldDescriptor("DAY", Date, 8, 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][]interface{}{{"aéé", day}, {nil, nil}} {
+		if err = w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dbf, err := OpenDBFFile(f.reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the name is cut before the character that does not fit
+	for _, want := range [][]interface{}{{"aé", day}, {"", nil}} {
+		row, err := dbf.NextRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(row, want) {
+			t.Errorf("got %v, want %v", row, want)
+		}
+	}
+	if got := dbf.Schema[1].GoType; got != reflect.TypeOf(day) {
+		t.Errorf("date column of type %v", got)
+	}
+
+	for _, test := range []struct {
+		t     FieldType
+		width int
+	}{{Number, 255}, {Character, 300}} {
+		fd := NewFieldDescriptor("F", test.t, 300, 0)
+		if got := fd.Width(); got != test.width {
+			t.Errorf("%c(300): width %d, want %d", test.t, got, test.width)
+		}
+	}
+}